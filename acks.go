@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	acksDB         = flag.String("acks-db", "", "Path to the database file for reviewer acknowledgements of resource diffs, disabled by default")
+	authUserHeader = flag.String("auth-user-header", "X-Forwarded-User", "Header with the authenticated user name, set by an auth proxy in front of the server, see -auth-trusted-proxies")
+	commentAcks    = flag.Bool("comment-acks", false, "Include the number of reviewed resource diffs in the comment, fetched from -plan-ui-url")
+	acksClientCert = flag.String("comment-acks-client-cert", "", "Client certificate file for fetching acks from a server with -tls-client-ca")
+	acksClientKey  = flag.String("comment-acks-client-key", "", "Private key file of -comment-acks-client-cert")
+)
+
+var acksBucket = []byte("acks")
+
+// ack is an acknowledgement of a resource diff by a reviewer.
+type ack struct {
+	Stack   string `json:"stack"`
+	Address string `json:"address"`
+	// DiffHash is the hash of the diff text at the moment of review, the ack is valid only while the diff is the same
+	DiffHash string    `json:"diff_hash"`
+	User     string    `json:"user"`
+	Time     time.Time `json:"time"`
+}
+
+// diffHash returns the hash used to detect changes in a diff between replans.
+func diffHash(diff string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(diff)))
+}
+
+type ackStore struct {
+	db   *bbolt.DB
+	auth *authenticator
+	// approvals updates the approval status after acks change, nil if -approval-status is disabled
+	approvals *commentPoster
+}
+
+func newAckStore(path string) (*ackStore, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(acksBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &ackStore{db: db}, nil
+}
+
+func ackKey(snapshot, stack, address string) []byte {
+	return []byte(snapshot + "\x00" + stack + "\x00" + address)
+}
+
+// list returns all acks of the snapshot, including stale ones.
+func (s *ackStore) list(snapshot string) ([]ack, error) {
+	var res []ack
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(acksBucket).Cursor()
+		prefix := []byte(snapshot + "\x00")
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var acks []ack
+			if err := json.Unmarshal(v, &acks); err != nil {
+				return err
+			}
+			res = append(res, acks...)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// set adds or replaces the ack of the user for the diff, or removes it if remove is true.
+func (s *ackStore) set(snapshot string, a ack, remove bool) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(acksBucket)
+		key := ackKey(snapshot, a.Stack, a.Address)
+
+		var acks []ack
+		if v := b.Get(key); v != nil {
+			if err := json.Unmarshal(v, &acks); err != nil {
+				return err
+			}
+		}
+
+		acks = slices.DeleteFunc(acks, func(o ack) bool { return o.User == a.User })
+		if !remove {
+			acks = append(acks, a)
+		}
+
+		if len(acks) == 0 {
+			return b.Delete(key)
+		}
+		v, err := json.Marshal(acks)
+		if err != nil {
+			return err
+		}
+		return b.Put(key, v)
+	})
+}
+
+// validAcks filters out acks of diffs that changed since the review, or that are not in the snapshot anymore.
+func validAcks(data uiData, acks []ack) []ack {
+	hashes := make(map[[2]string]string)
+	for _, s := range data.Stacks {
+		for _, d := range s.ResourceDiffs {
+			hashes[[2]string{s.Path, d.Address}] = d.DiffHash
+		}
+	}
+	// acks are shared between review progress and approval, don't modify them in place
+	return slices.DeleteFunc(slices.Clone(acks), func(a ack) bool {
+		h, ok := hashes[[2]string{a.Stack, a.Address}]
+		return !ok || h != a.DiffHash
+	})
+}
+
+// ackList is the response of the acks API.
+type ackList struct {
+	// User is the authenticated user making the request, empty if not authenticated
+	User string `json:"user"`
+	Acks []ack  `json:"acks"`
+}
+
+// reviewProgress counts resource diffs with at least one valid ack.
+type reviewProgress struct {
+	Reviewed int
+	Total    int
+}
+
+func getReviewProgress(data uiData, acks []ack) reviewProgress {
+	reviewed := make(map[[2]string]bool)
+	for _, a := range validAcks(data, acks) {
+		reviewed[[2]string{a.Stack, a.Address}] = true
+	}
+
+	var res reviewProgress
+	for _, s := range data.Stacks {
+		res.Total += len(s.ResourceDiffs)
+	}
+	res.Reviewed = len(reviewed)
+	return res
+}
+
+// readSnapshot reads the latest version of the snapshot from the output dir, and returns it with its hash.
+func readSnapshot(snapshot string) (uiData, string, error) {
+	var data uiData
+	if !fs.ValidPath(snapshot) {
+		return data, "", fmt.Errorf("invalid snapshot name")
+	}
+
+	jsonData, err := os.ReadFile(filepath.Join(*outputDir, snapshot+".json"))
+	if err != nil {
+		return data, "", err
+	}
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return data, "", err
+	}
+	hash, err := snapshotHash(data)
+	return data, hash, err
+}
+
+// ServeHTTP handles listing (GET), adding (POST) and removing (DELETE) acks.
+// Listing returns only acks valid for the latest snapshot of the PR.
+func (s *ackStore) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	snapshot := strings.Trim(r.URL.Query().Get("snapshot"), "/")
+	data, hash, err := readSnapshot(snapshot)
+	if err != nil {
+		http.Error(rw, "snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		acks, err := s.list(snapshot)
+		if err != nil {
+			slog.Error("failed to list acks", "snapshot", snapshot, "err", err)
+			http.Error(rw, "failed to list acks", http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(ackList{
+			User: s.auth.user(r),
+			Acks: validAcks(data, acks),
+		})
+		return
+	}
+
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := checkSameOrigin(r); err != nil {
+		http.Error(rw, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	user := s.auth.user(r)
+	if user == "" {
+		http.Error(rw, "not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var a ack
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 64<<10)).Decode(&a); err != nil {
+		http.Error(rw, "invalid request", http.StatusBadRequest)
+		return
+	}
+	a.User = user
+	a.Time = time.Now().UTC()
+
+	if len(validAcks(data, []ack{a})) == 0 {
+		// diff has changed since the page was loaded
+		http.Error(rw, "diff not found in the latest plan, reload the page", http.StatusConflict)
+		return
+	}
+
+	if err := s.set(snapshot, a, r.Method == http.MethodDelete); err != nil {
+		slog.Error("failed to store ack", "snapshot", snapshot, "err", err)
+		http.Error(rw, "failed to store ack", http.StatusInternalServerError)
+		return
+	}
+
+	if s.approvals != nil {
+		if err := s.updateApproval(snapshot, data, snapshotURL(*uiURL, data, hash)); err != nil {
+			// ack is stored, the status will be fixed by the next ack or plan
+			slog.Error("failed to update approval status", "snapshot", snapshot, "err", err)
+		}
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (s *ackStore) updateApproval(snapshot string, data uiData, link string) error {
+	acks, err := s.list(snapshot)
+	if err != nil {
+		return err
+	}
+	return s.approvals.updateApprovalStatus(data, acks, link)
+}
+
+// fetchAcks gets valid acks of the latest snapshot from the atlantis-plan-ui server.
+func fetchAcks(snapshot string) ([]ack, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if *acksClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(*acksClientCert, *acksClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	// the hook must not hang the Atlantis workflow when the server is unreachable
+	client := &http.Client{Timeout: 30 * time.Second, Transport: transport}
+
+	r, err := client.Get(strings.TrimRight(*uiURL, "/") + "/api/acks?snapshot=" + url.QueryEscape(snapshot))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", r.Status)
+	}
+
+	var res ackList
+	err = json.NewDecoder(r.Body).Decode(&res)
+	return res.Acks, err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAckStore(t *testing.T) {
+	old := *outputDir
+	*outputDir = t.TempDir()
+	defer func() { *outputDir = old }()
+
+	store, err := newAckStore(filepath.Join(t.TempDir(), "acks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.db.Close()
+	store.auth = &authenticator{proxies: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}}
+
+	const snapshot = "github.com/org/infra/7"
+	plan := func(runID, vpcDiff string) uiData {
+		stack := uiStack{Path: "prod/vpc"}
+		stack.ResourceDiffs = []uiDiff{
+			{Address: "aws_vpc.main", Diff: vpcDiff, DiffHash: diffHash(vpcDiff)},
+			{Address: "aws_subnet.a", Diff: "~ cidr", DiffHash: diffHash("~ cidr")},
+		}
+		data := uiData{VCSHost: "github.com", PRRepo: "org/infra", PRNum: 7, RunID: runID, Stacks: []uiStack{stack}}
+		if _, err := writeUIData(data); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	do := func(method, body string) (int, string) {
+		r := httptest.NewRequest(method, "/api/acks?snapshot="+snapshot, strings.NewReader(body))
+		r.Header.Set("X-Forwarded-User", "alice")
+		r.Header.Set("Content-Type", "application/json")
+		rw := httptest.NewRecorder()
+		store.ServeHTTP(rw, r)
+		return rw.Code, rw.Body.String()
+	}
+	ackBody := func(address, diff string) string {
+		return fmt.Sprintf(`{"stack":"prod/vpc","address":%q,"diff_hash":%q}`, address, diffHash(diff))
+	}
+	listed := func() []string {
+		code, body := do(http.MethodGet, "")
+		if code != http.StatusOK {
+			t.Fatalf("GET = %d %s", code, body)
+		}
+		var res ackList
+		if err := json.Unmarshal([]byte(body), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.User != "alice" {
+			t.Errorf("user = %q, want alice", res.User)
+		}
+		var addrs []string
+		for _, a := range res.Acks {
+			addrs = append(addrs, a.User+" "+a.Address)
+		}
+		return addrs
+	}
+	progress := func(data uiData) reviewProgress {
+		acks, err := store.list(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return getReviewProgress(data, acks)
+	}
+
+	data := plan("run1", "~ tags")
+	if code, body := do(http.MethodPost, ackBody("aws_vpc.main", "~ tags")); code != http.StatusNoContent {
+		t.Fatalf("POST = %d %s", code, body)
+	}
+	if code, _ := do(http.MethodPost, ackBody("aws_subnet.a", "~ stale")); code != http.StatusConflict {
+		t.Errorf("POST with a stale diff hash = %d, want %d", code, http.StatusConflict)
+	}
+	if code, _ := do(http.MethodPost, `{"stack":"`+strings.Repeat("x", 128<<10)+`"}`); code != http.StatusBadRequest {
+		t.Errorf("POST with a big body = %d, want %d", code, http.StatusBadRequest)
+	}
+	if got := listed(); len(got) != 1 || got[0] != "alice aws_vpc.main" {
+		t.Errorf("acks = %v, want alice's ack of aws_vpc.main", got)
+	}
+	if got := progress(data); got != (reviewProgress{Reviewed: 1, Total: 2}) {
+		t.Errorf("progress = %+v, want 1 of 2", got)
+	}
+
+	// replan with the same diffs keeps the ack
+	data = plan("run2", "~ tags")
+	if got := listed(); len(got) != 1 {
+		t.Errorf("acks after identical replan = %v, want one", got)
+	}
+	if got := progress(data); got != (reviewProgress{Reviewed: 1, Total: 2}) {
+		t.Errorf("progress after identical replan = %+v, want 1 of 2", got)
+	}
+
+	// replan with a changed diff invalidates it
+	data = plan("run3", "~ tags\n~ cidr_block")
+	if got := listed(); len(got) != 0 {
+		t.Errorf("acks after replan with a changed diff = %v, want none", got)
+	}
+	if got := progress(data); got != (reviewProgress{Reviewed: 0, Total: 2}) {
+		t.Errorf("progress after replan with a changed diff = %+v, want 0 of 2", got)
+	}
+
+	// the diff can be acked again, and unacked
+	if code, body := do(http.MethodPost, ackBody("aws_vpc.main", "~ tags\n~ cidr_block")); code != http.StatusNoContent {
+		t.Fatalf("POST = %d %s", code, body)
+	}
+	if got := progress(data); got != (reviewProgress{Reviewed: 1, Total: 2}) {
+		t.Errorf("progress after new ack = %+v, want 1 of 2", got)
+	}
+	if code, body := do(http.MethodDelete, ackBody("aws_vpc.main", "~ tags\n~ cidr_block")); code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s", code, body)
+	}
+	if acks, err := store.list(snapshot); err != nil || len(acks) != 0 {
+		t.Errorf("list() after DELETE = %v, %v, want no acks", acks, err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+)
+
+// uiResourceGroup is a number of changes of resources with the same type, module, and action.
+type uiResourceGroup struct {
+	Type     string `json:"type"`
+	Provider string `json:"provider"`
+	// Module is the module address, e.g. `module.network.module.subnets`, empty for the root module
+	Module string `json:"module,omitempty"`
+	// Action is one of create, update, delete, replace, forget, import
+	Action string `json:"action"`
+	Count  int    `json:"count"`
+}
+
+// resourceAction returns a single action name for the list of Terraform actions.
+func resourceAction(ch tfChange) string {
+	switch {
+	case len(ch.Actions) == 2:
+		// delete-create, create-delete, create-forget
+		return "replace"
+	case slices.Equal(ch.Actions, []string{"no-op"}) && ch.Importing != nil:
+		return "import"
+	case len(ch.Actions) == 1:
+		return ch.Actions[0]
+	}
+	return "unknown"
+}
+
+// addResourceGroups adds counts from src to dst, merging groups with the same key.
+func addResourceGroups(dst []uiResourceGroup, src ...uiResourceGroup) []uiResourceGroup {
+	for _, g := range src {
+		i := slices.IndexFunc(dst, func(d uiResourceGroup) bool {
+			return d.Type == g.Type && d.Provider == g.Provider && d.Module == g.Module && d.Action == g.Action
+		})
+		if i == -1 {
+			dst = append(dst, g)
+		} else {
+			dst[i].Count += g.Count
+		}
+	}
+	return dst
+}
+
+// sortResourceGroups orders groups by count, largest first, then by type, module and action.
+func sortResourceGroups(groups []uiResourceGroup) {
+	slices.SortFunc(groups, func(l, r uiResourceGroup) int {
+		return cmp.Or(
+			cmp.Compare(r.Count, l.Count),
+			cmp.Compare(l.Type, r.Type),
+			cmp.Compare(l.Module, r.Module),
+			cmp.Compare(l.Action, r.Action),
+		)
+	})
+}
+
+// pullResourceGroups sums resource groups of all stacks in the PR.
+func pullResourceGroups(stacks []uiStack) []uiResourceGroup {
+	var res []uiResourceGroup
+	for _, s := range stacks {
+		res = addResourceGroups(res, s.ResourceGroups...)
+	}
+	sortResourceGroups(res)
+	return res
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPullResourceGroups(t *testing.T) {
+	const aws = "registry.terraform.io/hashicorp/aws"
+	stack := func(groups ...uiResourceGroup) uiStack {
+		s := uiStack{}
+		s.ResourceGroups = groups
+		return s
+	}
+
+	got := pullResourceGroups([]uiStack{
+		stack(
+			uiResourceGroup{Type: "aws_security_group_rule", Provider: aws, Module: "module.sg", Action: "update", Count: 7},
+			uiResourceGroup{Type: "aws_security_group_rule", Provider: aws, Action: "update", Count: 2},
+		),
+		stack(
+			uiResourceGroup{Type: "aws_security_group_rule", Provider: aws, Module: "module.sg", Action: "update", Count: 5},
+			uiResourceGroup{Type: "aws_security_group_rule", Provider: aws, Module: "module.sg", Action: "delete", Count: 2},
+			uiResourceGroup{Type: "aws_iam_role", Provider: aws, Action: "create", Count: 2},
+		),
+	})
+
+	want := []uiResourceGroup{
+		{Type: "aws_security_group_rule", Provider: aws, Module: "module.sg", Action: "update", Count: 12},
+		{Type: "aws_iam_role", Provider: aws, Action: "create", Count: 2},
+		{Type: "aws_security_group_rule", Provider: aws, Action: "update", Count: 2},
+		{Type: "aws_security_group_rule", Provider: aws, Module: "module.sg", Action: "delete", Count: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pullResourceGroups() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/runatlantis/atlantis/server/events/models"
+)
+
+var approvalStatus = flag.Bool("approval-status", false, "Set a commit status, which succeeds once all deletes and replacements are acknowledged by someone other than the PR author, requires -atlantis-config")
+
+// approvalStatusContext is the commit status name, to be used in branch protection or Atlantis apply requirements.
+const approvalStatusContext = "atlantis-plan-ui/approval"
+
+// approval counts destructive resource diffs and the ones acknowledged by someone other than the PR author.
+type approval struct {
+	Approved int
+	Total    int
+	// Unknown is the number of stacks which failed to plan, convert, or are locked, their changes can't be reviewed
+	Unknown int
+}
+
+// clean returns true if there is nothing to review, all stacks are known to have no deletes or replacements.
+func (a approval) clean() bool {
+	return a.Total == 0 && a.Unknown == 0
+}
+
+// isDestructive returns true for deletes and replacements, forgets don't touch the infrastructure.
+func isDestructive(actions []string) bool {
+	return slices.Contains(actions, "delete")
+}
+
+func getApproval(data uiData, acks []ack) approval {
+	approved := make(map[[2]string]bool)
+	for _, a := range validAcks(data, acks) {
+		if !strings.EqualFold(a.User, data.PRAuthor) {
+			approved[[2]string{a.Stack, a.Address}] = true
+		}
+	}
+
+	var res approval
+	for _, s := range data.Stacks {
+		// locked stacks have PlanError set too
+		if s.PlanError || s.ConversionError != "" {
+			res.Unknown++
+			continue
+		}
+		for _, d := range s.ResourceDiffs {
+			if !isDestructive(d.Actions) {
+				continue
+			}
+			res.Total++
+			if approved[[2]string{s.Path, d.Address}] {
+				res.Approved++
+			}
+		}
+	}
+	return res
+}
+
+func (a approval) status() (models.CommitStatus, string) {
+	switch {
+	case a.Unknown > 0:
+		// a replan is needed, acks can't fix it
+		return models.FailedCommitStatus, fmt.Sprintf("%d stacks failed to plan or convert, or are locked", a.Unknown)
+	case a.Total == 0:
+		return models.SuccessCommitStatus, "No deletes or replacements"
+	case a.Approved == a.Total:
+		return models.SuccessCommitStatus, fmt.Sprintf("All %d deletes and replacements reviewed", a.Total)
+	default:
+		return models.PendingCommitStatus, fmt.Sprintf("%d/%d deletes and replacements reviewed by non-authors", a.Approved, a.Total)
+	}
+}
+
+// snapshotPull restores the Atlantis pull model from the snapshot, with the fields VCS clients use for statuses.
+func snapshotPull(data uiData) (models.Repo, models.PullRequest, error) {
+	repo, err := snapshotRepo(data)
+	if err != nil {
+		return models.Repo{}, models.PullRequest{}, err
+	}
+	return repo, models.PullRequest{
+		Num:        data.PRNum,
+		HeadCommit: data.PRHeadCommit,
+		HeadBranch: data.PRHeadBranch,
+		URL:        data.PRURL,
+		Author:     data.PRAuthor,
+		BaseRepo:   repo,
+	}, nil
+}
+
+// updateApprovalStatus sets the approval status on the head commit of the snapshot's PR.
+func (p commentPoster) updateApprovalStatus(data uiData, acks []ack, link string) error {
+	if data.PRHeadCommit == "" {
+		return fmt.Errorf("snapshot doesn't have the head commit, it was created by an older version")
+	}
+
+	repo, pull, err := snapshotPull(data)
+	if err != nil {
+		return err
+	}
+
+	state, description := getApproval(data, acks).status()
+	return p.client.UpdateStatus(atlantisLogger, repo, pull, state, approvalStatusContext, description, link)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/runatlantis/atlantis/server/events/models"
+)
+
+func TestApprovalStatus(t *testing.T) {
+	replace := uiDiff{Address: "aws_instance.a", Actions: []string{"delete", "create"}, DiffHash: "h1"}
+	update := uiDiff{Address: "aws_instance.b", Actions: []string{"update"}, DiffHash: "h2"}
+
+	stack := func(path string, diffs ...uiDiff) uiStack {
+		s := uiStack{Path: path}
+		s.ResourceDiffs = diffs
+		return s
+	}
+	planErrored := uiStack{Path: "errored", PlanError: true}
+	locked := uiStack{Path: "locked", PlanError: true, LockURL: "http://atlantis/lock?id=x"}
+	conversionErrored := uiStack{Path: "broken", ConversionError: "failed to parse JSON plan"}
+
+	for _, tc := range []struct {
+		name      string
+		stacks    []uiStack
+		acks      []ack
+		wantState models.CommitStatus
+		wantDesc  string
+		wantClean bool
+	}{
+		{
+			name:      "no changes",
+			stacks:    []uiStack{stack("a", update)},
+			wantState: models.SuccessCommitStatus,
+			wantDesc:  "No deletes or replacements",
+			wantClean: true,
+		},
+		{
+			name:      "unreviewed replace",
+			stacks:    []uiStack{stack("a", replace, update)},
+			wantState: models.PendingCommitStatus,
+			wantDesc:  "0/1 deletes and replacements reviewed by non-authors",
+		},
+		{
+			name:      "replace reviewed by author",
+			stacks:    []uiStack{stack("a", replace)},
+			acks:      []ack{{Stack: "a", Address: replace.Address, DiffHash: "h1", User: "Author"}},
+			wantState: models.PendingCommitStatus,
+			wantDesc:  "0/1 deletes and replacements reviewed by non-authors",
+		},
+		{
+			name:      "replace reviewed",
+			stacks:    []uiStack{stack("a", replace)},
+			acks:      []ack{{Stack: "a", Address: replace.Address, DiffHash: "h1", User: "reviewer"}},
+			wantState: models.SuccessCommitStatus,
+			wantDesc:  "All 1 deletes and replacements reviewed",
+		},
+		{
+			name:      "stale ack",
+			stacks:    []uiStack{stack("a", replace)},
+			acks:      []ack{{Stack: "a", Address: replace.Address, DiffHash: "old", User: "reviewer"}},
+			wantState: models.PendingCommitStatus,
+			wantDesc:  "0/1 deletes and replacements reviewed by non-authors",
+		},
+		{
+			name:      "plan error",
+			stacks:    []uiStack{stack("a", update), planErrored},
+			wantState: models.FailedCommitStatus,
+			wantDesc:  "1 stacks failed to plan or convert, or are locked",
+		},
+		{
+			name:      "errors with reviewed replace",
+			stacks:    []uiStack{stack("a", replace), locked, conversionErrored},
+			acks:      []ack{{Stack: "a", Address: replace.Address, DiffHash: "h1", User: "reviewer"}},
+			wantState: models.FailedCommitStatus,
+			wantDesc:  "2 stacks failed to plan or convert, or are locked",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := uiData{PRAuthor: "author", Stacks: tc.stacks}
+			a := getApproval(data, tc.acks)
+			state, desc := a.status()
+			if state != tc.wantState || desc != tc.wantDesc {
+				t.Errorf("status() = %v, %q, want %v, %q", state, desc, tc.wantState, tc.wantDesc)
+			}
+			if a.clean() != tc.wantClean {
+				t.Errorf("clean() = %v, want %v", a.clean(), tc.wantClean)
+			}
+		})
+	}
+}
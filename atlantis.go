@@ -25,6 +25,20 @@ type atlantisFlags struct {
 }
 
 func getAtlantisFlags() (*atlantisFlags, error) {
+	userConfig, err := getAtlantisUserConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &atlantisFlags{
+		AtlantisDB:     path.Join(userConfig.DataDir, "atlantis.db"),
+		AtlantisURL:    userConfig.AtlantisURL,
+		ExecutableName: userConfig.ExecutableName,
+	}, nil
+}
+
+// getAtlantisUserConfig returns the full Atlantis config, including secrets, so it must not be logged.
+func getAtlantisUserConfig() (server.UserConfig, error) {
 	srvCreator := &serverConfigRecorder{}
 
 	// safe to run without change of data-dir because serverConfigRecorder only records the userConfig
@@ -32,15 +46,7 @@ func getAtlantisFlags() (*atlantisFlags, error) {
 	args := []string{"--config", *atlantisConfig}
 
 	err := startAtlantis(srvCreator, args)
-	if err != nil {
-		return nil, err
-	}
-
-	return &atlantisFlags{
-		AtlantisDB:     path.Join(srvCreator.userConfig.DataDir, "atlantis.db"),
-		AtlantisURL:    srvCreator.userConfig.AtlantisURL,
-		ExecutableName: srvCreator.userConfig.ExecutableName,
-	}, nil
+	return srvCreator.userConfig, err
 }
 
 func getCommentPoster() (*commentPoster, error) {
@@ -50,7 +56,8 @@ func getCommentPoster() (*commentPoster, error) {
 	dir := os.TempDir()
 	defer os.RemoveAll(dir)
 
-	args := []string{"--data-dir", dir, "--log-level", "error", "--config", *atlantisConfig}
+	_, level := atlantisLogLevel()
+	args := []string{"--data-dir", dir, "--log-level", level, "--config", *atlantisConfig}
 
 	err := startAtlantis(srvCreator, args)
 	if err != nil {
@@ -68,13 +75,17 @@ func (p commentPoster) postComment(repo models.Repo, pullNum int, body string) e
 	return p.client.CreateComment(atlantisLogger, repo, pullNum, body, "post-workflow-hook")
 }
 
+func (p commentPoster) postReviewComment(repo models.Repo, pullNum int, body string) error {
+	return p.client.CreateComment(atlantisLogger, repo, pullNum, body, "plan-ui-review")
+}
+
 func startAtlantis(creator atlantiscmd.ServerCreator, args []string) error {
 	if *atlantisConfig == "" {
 		return fmt.Errorf("-atlantis-config flag is required")
 	}
 
-	atlantisLogger, _ = logging.NewStructuredLogger()
-	atlantisLogger.SetLevel(logging.Error)
+	level, _ := atlantisLogLevel()
+	atlantisLogger, _ = logging.NewStructuredLoggerFromLevel(level)
 
 	c := &atlantiscmd.ServerCmd{
 		ServerCreator: creator,
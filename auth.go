@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	authTrustedProxies  = flag.String("auth-trusted-proxies", "", "Comma-separated CIDRs of auth proxies, -auth-user-header is accepted only from them")
+	authProxySecretFile = flag.String("auth-proxy-secret-file", "", "File with a secret the auth proxy sends in the X-Auth-Proxy-Secret header, -auth-user-header is accepted only with it")
+)
+
+// authProxySecretHeader carries the secret shared with the auth proxy, see -auth-proxy-secret-file.
+const authProxySecretHeader = "X-Auth-Proxy-Secret"
+
+// authenticator tells who makes the request, trusting -auth-user-header only if it's set by a trusted proxy,
+// as the server might be reachable directly, and anyone could set the header then.
+// With -tls-client-ca, the common name of the verified client certificate is the user for direct requests.
+type authenticator struct {
+	proxies     []netip.Prefix
+	secret      string
+	clientCerts bool
+}
+
+// newAuthenticator returns the authenticator configured by flags, or an error if there is no trusted source of user names.
+func newAuthenticator() (*authenticator, error) {
+	a := &authenticator{clientCerts: *tlsClientCA != ""}
+	for _, cidr := range strings.Split(*authTrustedProxies, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -auth-trusted-proxies: %w", err)
+		}
+		a.proxies = append(a.proxies, prefix)
+	}
+
+	if *authProxySecretFile != "" {
+		secret, err := os.ReadFile(*authProxySecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read -auth-proxy-secret-file: %w", err)
+		}
+		a.secret = strings.TrimSpace(string(secret))
+		if a.secret == "" {
+			return nil, fmt.Errorf("-auth-proxy-secret-file is empty")
+		}
+	}
+
+	if len(a.proxies) == 0 && a.secret == "" && !a.clientCerts {
+		return nil, fmt.Errorf("no trusted source of user names, specify -auth-trusted-proxies, -auth-proxy-secret-file or -tls-client-ca")
+	}
+	return a, nil
+}
+
+// user returns the authenticated user name, or an empty string if the request is not authenticated.
+func (a *authenticator) user(r *http.Request) string {
+	if a.fromTrustedProxy(r) {
+		return r.Header.Get(*authUserHeader)
+	}
+	// the proxy might connect with a client certificate too, so the header is checked first
+	if a.clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	return ""
+}
+
+func (a *authenticator) fromTrustedProxy(r *http.Request) bool {
+	if a.secret != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(authProxySecretHeader)), []byte(a.secret)) == 1 {
+		return true
+	}
+
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(a.proxies, func(p netip.Prefix) bool {
+		return p.Contains(addr.Addr().Unmap())
+	})
+}
+
+// checkSameOrigin rejects cross-site requests changing data, as cookies of the auth proxy are sent with them.
+// JSON content type can't be sent cross-site without a CORS preflight, which the server never allows.
+func checkSameOrigin(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return fmt.Errorf("content type must be application/json")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser, or an old one, which doesn't send cross-site requests with JSON content type either
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin")
+	}
+
+	hosts := []string{r.Host}
+	if ui, err := url.Parse(*uiURL); err == nil && ui.Host != "" {
+		// the proxy in front might rewrite the host
+		hosts = append(hosts, ui.Host)
+	}
+	if !slices.Contains(hosts, u.Host) {
+		return fmt.Errorf("cross-origin request from %s", origin)
+	}
+	return nil
+}
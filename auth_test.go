@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestAuthenticatorUser(t *testing.T) {
+	a := &authenticator{
+		proxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		secret:  "s3cret",
+	}
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		secret     string
+		want       string
+	}{
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:5000", want: "alice"},
+		{name: "trusted proxy over IPv4-mapped IPv6", remoteAddr: "[::ffff:10.1.2.3]:5000", want: "alice"},
+		{name: "direct request", remoteAddr: "192.168.1.1:5000", want: ""},
+		{name: "direct request with secret", remoteAddr: "192.168.1.1:5000", secret: "s3cret", want: "alice"},
+		{name: "direct request with wrong secret", remoteAddr: "192.168.1.1:5000", secret: "guess", want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/acks", nil)
+			r.RemoteAddr = tc.remoteAddr
+			r.Header.Set("X-Forwarded-User", "alice")
+			if tc.secret != "" {
+				r.Header.Set(authProxySecretHeader, tc.secret)
+			}
+			if got := a.user(r); got != tc.want {
+				t.Errorf("user() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckSameOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		origin      string
+		wantErr     bool
+	}{
+		{name: "same origin", contentType: "application/json", origin: "https://plans.example.com"},
+		{name: "no origin", contentType: "application/json; charset=utf-8"},
+		{name: "form post", contentType: "text/plain", origin: "https://plans.example.com", wantErr: true},
+		{name: "no content type", wantErr: true},
+		{name: "cross origin", contentType: "application/json", origin: "https://evil.example.com", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "https://plans.example.com/api/acks", nil)
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.origin != "" {
+				r.Header.Set("Origin", tc.origin)
+			}
+			if err := checkSameOrigin(r); (err != nil) != tc.wantErr {
+				t.Errorf("checkSameOrigin() = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	manifestFile = flag.String("manifest", "", "Read the PR and its stacks from the JSON manifest instead of Atlantis, for other CI systems")
+	ciEnv        = flag.Bool("ci-env", false, "Read the PR from CI environment variables (GitHub Actions, GitLab CI, or PLAN_UI_*) instead of Atlantis, stacks are found in -plans-dir")
+)
+
+// changeSet is a PR with its stacks, independent of the system that planned them.
+// It's also the format of -manifest files.
+type changeSet struct {
+	// ExecutableName is the Atlantis comment command, used for copying apply commands in the UI
+	ExecutableName string `json:"executable_name"`
+
+	VCSHost string `json:"vcs_host"`
+	// VCSType is the Atlantis VCS type name, e.g. Github or Gitlab, required for commenting
+	VCSType    string `json:"vcs_type"`
+	Repo       string `json:"repo"`
+	Num        int    `json:"num"`
+	URL        string `json:"url"`
+	CloneURL   string `json:"clone_url"`
+	Author     string `json:"author"`
+	HeadCommit string `json:"head_commit"`
+	HeadBranch string `json:"head_branch"`
+	BaseBranch string `json:"base_branch"`
+
+	Stacks []changeSetStack `json:"stacks"`
+}
+
+type changeSetStack struct {
+	Name string `json:"name"`
+	// Path is the stack dir relative to the repo root
+	Path string `json:"path"`
+	// Workspace is the Terraform workspace, used in logs only
+	Workspace string `json:"workspace,omitempty"`
+
+	// PlanDir is the dir with plan.json and plan.txt
+	PlanDir string `json:"plan_dir"`
+	// PlanFile is the binary plan, shown with -terraform-bin instead of reading PlanDir
+	PlanFile string `json:"plan_file,omitempty"`
+
+	PlanError bool           `json:"plan_error,omitempty"`
+	LogURL    string         `json:"log_url,omitempty"`
+	Lock      *changeSetLock `json:"lock,omitempty"`
+}
+
+// changeSetLock is a lock of the stack by another PR.
+type changeSetLock struct {
+	URL      string `json:"url"`
+	PRURL    string `json:"pr_url"`
+	PRAuthor string `json:"pr_author"`
+}
+
+// loadChangeSet reads the change set from the source selected by flags, Atlantis by default.
+func loadChangeSet() (changeSet, error) {
+	switch {
+	case *manifestFile != "":
+		return manifestChangeSet(*manifestFile)
+	case *ciEnv:
+		return envChangeSet()
+	default:
+		return loadAtlantisChangeSet()
+	}
+}
+
+// manifestChangeSet reads the change set from a JSON file, relative plan paths are resolved from the file's dir.
+func manifestChangeSet(fname string) (changeSet, error) {
+	var res changeSet
+	jsonData, err := os.ReadFile(fname)
+	if err != nil {
+		return res, err
+	}
+	if err := json.Unmarshal(jsonData, &res); err != nil {
+		return res, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if res.VCSHost == "" || res.Repo == "" {
+		return res, fmt.Errorf("manifest doesn't have vcs_host or repo")
+	}
+
+	dir := filepath.Dir(fname)
+	for i := range res.Stacks {
+		s := &res.Stacks[i]
+		if s.PlanDir != "" && !filepath.IsAbs(s.PlanDir) {
+			s.PlanDir = filepath.Join(dir, s.PlanDir)
+		}
+		if s.PlanFile != "" && !filepath.IsAbs(s.PlanFile) {
+			s.PlanFile = filepath.Join(dir, s.PlanFile)
+		}
+	}
+	return res, nil
+}
+
+// githubEventPull is the PR of pull_request and pull_request_target events.
+type githubEventPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	User    struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Head struct {
+		SHA string `json:"sha"`
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// readGithubEventPull reads the PR from the event payload of the workflow run, nil for events without a PR.
+func readGithubEventPull(fname string) (*githubEventPull, error) {
+	if fname == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	var event struct {
+		PullRequest *githubEventPull `json:"pull_request"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return event.PullRequest, nil
+}
+
+// envChangeSet reads the PR from variables of known CI systems, PLAN_UI_* variables take precedence.
+func envChangeSet() (changeSet, error) {
+	if *plansDir == "" {
+		flag.Usage()
+		return changeSet{}, fmt.Errorf("no -plans-dir specified")
+	}
+
+	var res changeSet
+	var num string
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		serverURL := strings.TrimSuffix(os.Getenv("GITHUB_SERVER_URL"), "/")
+		res.VCSHost = strings.TrimPrefix(strings.TrimPrefix(serverURL, "https://"), "http://")
+		res.VCSType = "Github"
+		res.Repo = os.Getenv("GITHUB_REPOSITORY")
+		// GITHUB_ACTOR is whoever triggered the run, and GITHUB_SHA is the merge commit, so the PR is read from the event
+		pr, err := readGithubEventPull(os.Getenv("GITHUB_EVENT_PATH"))
+		if err != nil {
+			return res, fmt.Errorf("failed to read GitHub event: %w", err)
+		}
+		if pr != nil {
+			num = strconv.Itoa(pr.Number)
+			res.URL = pr.HTMLURL
+			res.Author = pr.User.Login
+			res.HeadCommit = pr.Head.SHA
+			res.HeadBranch = pr.Head.Ref
+			res.BaseBranch = pr.Base.Ref
+		}
+
+	case os.Getenv("GITLAB_CI") == "true":
+		res.VCSHost = os.Getenv("CI_SERVER_HOST")
+		res.VCSType = "Gitlab"
+		res.Repo = os.Getenv("CI_PROJECT_PATH")
+		num = os.Getenv("CI_MERGE_REQUEST_IID")
+		if num != "" {
+			res.URL = fmt.Sprintf("%s/-/merge_requests/%s", os.Getenv("CI_MERGE_REQUEST_PROJECT_URL"), num)
+		}
+		// CI_COMMIT_SHA is the merge commit in merged results pipelines, the source branch SHA is set only there
+		res.HeadCommit = os.Getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_SHA")
+		if res.HeadCommit == "" {
+			res.HeadCommit = os.Getenv("CI_COMMIT_SHA")
+		}
+		// GITLAB_USER_LOGIN is whoever triggered the pipeline, so the author is read from the MR
+		if num != "" && os.Getenv("PLAN_UI_AUTHOR") == "" {
+			author, err := fetchGitlabMRAuthor(os.Getenv("CI_SERVER_URL"), os.Getenv("PLAN_UI_GITLAB_TOKEN"), res.Repo, num)
+			if err != nil {
+				return res, fmt.Errorf("failed to get MR author, set PLAN_UI_GITLAB_TOKEN or PLAN_UI_AUTHOR: %w", err)
+			}
+			res.Author = author
+		}
+		res.HeadBranch = os.Getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME")
+		res.BaseBranch = os.Getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME")
+	}
+
+	for key, val := range map[string]*string{
+		"PLAN_UI_VCS_HOST":    &res.VCSHost,
+		"PLAN_UI_VCS_TYPE":    &res.VCSType,
+		"PLAN_UI_REPO":        &res.Repo,
+		"PLAN_UI_PULL":        &num,
+		"PLAN_UI_PULL_URL":    &res.URL,
+		"PLAN_UI_AUTHOR":      &res.Author,
+		"PLAN_UI_HEAD_COMMIT": &res.HeadCommit,
+		"PLAN_UI_HEAD_BRANCH": &res.HeadBranch,
+		"PLAN_UI_BASE_BRANCH": &res.BaseBranch,
+	} {
+		if v := os.Getenv(key); v != "" {
+			*val = v
+		}
+	}
+
+	if res.VCSHost == "" || res.Repo == "" || num == "" {
+		return res, fmt.Errorf("VCS host, repo or PR number not found in environment, set PLAN_UI_VCS_HOST, PLAN_UI_REPO and PLAN_UI_PULL")
+	}
+	var err error
+	if res.Num, err = strconv.Atoi(num); err != nil {
+		return res, fmt.Errorf("invalid PR number %q: %w", num, err)
+	}
+
+	res.Stacks, err = findLocalPlans(*plansDir)
+	return res, err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvChangeSetGithub(t *testing.T) {
+	dir := t.TempDir()
+	event := filepath.Join(dir, "event.json")
+	err := os.WriteFile(event, []byte(`{
+		"action": "synchronize",
+		"pull_request": {
+			"number": 42,
+			"html_url": "https://github.com/org/infra/pull/42",
+			"user": {"login": "author"},
+			"head": {"sha": "headsha", "ref": "feature"},
+			"base": {"ref": "main"}
+		}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GITLAB_CI", "")
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_SERVER_URL", "https://github.com")
+	t.Setenv("GITHUB_REPOSITORY", "org/infra")
+	t.Setenv("GITHUB_EVENT_PATH", event)
+	// these describe the run, not the PR
+	t.Setenv("GITHUB_ACTOR", "maintainer")
+	t.Setenv("GITHUB_SHA", "mergesha")
+	t.Setenv("GITHUB_REF", "refs/pull/42/merge")
+
+	old := *plansDir
+	*plansDir = dir
+	defer func() { *plansDir = old }()
+
+	cs, err := envChangeSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := changeSet{
+		VCSHost:    "github.com",
+		VCSType:    "Github",
+		Repo:       "org/infra",
+		Num:        42,
+		URL:        "https://github.com/org/infra/pull/42",
+		Author:     "author",
+		HeadCommit: "headsha",
+		HeadBranch: "feature",
+		BaseBranch: "main",
+	}
+	if !reflect.DeepEqual(cs, want) {
+		t.Errorf("envChangeSet() = %+v, want %+v", cs, want)
+	}
+}
+
+func TestEnvChangeSetGitlab(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/org%2Finfra/merge_requests/42" || r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"iid": 42, "author": {"username": "author"}}`))
+	}))
+	defer srv.Close()
+
+	t.Setenv("GITHUB_ACTIONS", "")
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_SERVER_HOST", "gitlab.com")
+	t.Setenv("CI_SERVER_URL", srv.URL)
+	t.Setenv("CI_PROJECT_PATH", "org/infra")
+	t.Setenv("CI_MERGE_REQUEST_IID", "42")
+	t.Setenv("CI_MERGE_REQUEST_PROJECT_URL", "https://gitlab.com/org/infra")
+	t.Setenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "feature")
+	t.Setenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME", "main")
+	t.Setenv("PLAN_UI_GITLAB_TOKEN", "secret")
+	t.Setenv("PLAN_UI_AUTHOR", "")
+	// the user who triggered the pipeline, not the MR author
+	t.Setenv("GITLAB_USER_LOGIN", "maintainer")
+
+	old := *plansDir
+	*plansDir = t.TempDir()
+	defer func() { *plansDir = old }()
+
+	want := changeSet{
+		VCSHost:    "gitlab.com",
+		VCSType:    "Gitlab",
+		Repo:       "org/infra",
+		Num:        42,
+		URL:        "https://gitlab.com/org/infra/-/merge_requests/42",
+		Author:     "author",
+		HeadBranch: "feature",
+		BaseBranch: "main",
+	}
+	for _, tc := range []struct {
+		name      string
+		commitSHA string
+		sourceSHA string
+		want      string
+	}{
+		{name: "merged results pipeline", commitSHA: "mergesha", sourceSHA: "headsha", want: "headsha"},
+		{name: "MR pipeline", commitSHA: "headsha", want: "headsha"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CI_COMMIT_SHA", tc.commitSHA)
+			t.Setenv("CI_MERGE_REQUEST_SOURCE_BRANCH_SHA", tc.sourceSHA)
+			cs, err := envChangeSet()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := want
+			want.HeadCommit = tc.want
+			if !reflect.DeepEqual(cs, want) {
+				t.Errorf("envChangeSet() = %+v, want %+v", cs, want)
+			}
+		})
+	}
+
+	t.Run("no token", func(t *testing.T) {
+		t.Setenv("PLAN_UI_GITLAB_TOKEN", "")
+		if _, err := envChangeSet(); err == nil {
+			t.Error("envChangeSet() succeeded without a way to get the MR author")
+		}
+	})
+}
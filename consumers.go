@@ -0,0 +1,240 @@
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var consumersScanRepo = flag.Bool("consumers-scan-repo", false, "Look for consumers of changed outputs in the whole -repo-dir, not only in stacks of the PR")
+
+// outputRef is a reference from a stack to an output of another stack.
+type outputRef struct {
+	// producer is the repo-relative dir of the stack with the output
+	producer string
+	output   string
+}
+
+// annotateOutputConsumers fills consumers of changed outputs, stacks that read them through
+// Terragrunt `dependency.*.outputs` or `terraform_remote_state` data sources.
+func annotateOutputConsumers(root string, stacks []uiStack, scanRepo bool) error {
+	var producers []string
+	for _, s := range stacks {
+		if len(s.OutputDiffs) > 0 {
+			producers = append(producers, s.Path)
+		}
+	}
+	if len(producers) == 0 {
+		return nil
+	}
+
+	candidates, err := consumerCandidates(root, stacks, scanRepo)
+	if err != nil {
+		return err
+	}
+
+	consumers := make(map[outputRef][]string)
+	for _, stack := range candidates {
+		refs, err := collectOutputRefs(root, stack, producers)
+		if err != nil {
+			slog.Warn("failed to collect output references", "path", stack, "err", err)
+			continue
+		}
+		for _, ref := range refs {
+			if ref.producer != stack && !slices.Contains(consumers[ref], stack) {
+				consumers[ref] = append(consumers[ref], stack)
+			}
+		}
+	}
+
+	for i := range stacks {
+		for j, diff := range stacks[i].OutputDiffs {
+			c := consumers[outputRef{producer: stacks[i].Path, output: diff.Address}]
+			slices.Sort(c)
+			stacks[i].OutputDiffs[j].Consumers = c
+		}
+	}
+	return nil
+}
+
+// consumerCandidates returns repo-relative dirs of stacks which might consume outputs.
+func consumerCandidates(root string, stacks []uiStack, scanRepo bool) ([]string, error) {
+	var res []string
+	if !scanRepo {
+		for _, s := range stacks {
+			if !slices.Contains(res, s.Path) {
+				res = append(res, s.Path)
+			}
+		}
+		return res, nil
+	}
+
+	err := walkFiles(root, func(path string, d fs.DirEntry) error {
+		if d.Name() != "terragrunt.hcl" && filepath.Ext(d.Name()) != ".tf" {
+			return nil
+		}
+
+		stack, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(res, stack) {
+			res = append(res, stack)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// collectOutputRefs returns references from the stack to outputs of producers.
+func collectOutputRefs(root, stack string, producers []string) ([]outputRef, error) {
+	dir := filepath.Join(root, stack)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []outputRef
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		// maps name of the dependency or the remote state to the producer stack
+		var sources map[string]string
+		var prefix []string
+
+		switch {
+		case e.Name() == "terragrunt.hcl":
+			prefix = []string{"dependency"}
+		case filepath.Ext(e.Name()) == ".tf":
+			prefix = []string{"data", "terraform_remote_state"}
+		default:
+			continue
+		}
+
+		body, err := parseHCLFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if prefix[0] == "dependency" {
+			sources = terragruntDeps(root, stack, body)
+		} else {
+			sources = remoteStateSources(root, stack, body, producers)
+		}
+		if len(sources) == 0 {
+			continue
+		}
+
+		_ = hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+			expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+			if !ok {
+				return nil
+			}
+			name, output, ok := outputTraversal(expr.Traversal, prefix)
+			if !ok {
+				return nil
+			}
+			if producer := sources[name]; slices.Contains(producers, producer) {
+				res = append(res, outputRef{producer: producer, output: output})
+			}
+			return nil
+		})
+	}
+	return res, nil
+}
+
+// outputTraversal matches `<prefix>.<name>.outputs.<output>` traversals, e.g. `dependency.vpc.outputs.vpc_id`.
+func outputTraversal(t hcl.Traversal, prefix []string) (string, string, bool) {
+	var parts []string
+	for _, step := range t {
+		switch step := step.(type) {
+		case hcl.TraverseRoot:
+			parts = append(parts, step.Name)
+		case hcl.TraverseAttr:
+			parts = append(parts, step.Name)
+		case hcl.TraverseIndex:
+			if step.Key.Type() != cty.String {
+				return "", "", false
+			}
+			parts = append(parts, step.Key.AsString())
+		}
+		if len(parts) == len(prefix)+3 {
+			break
+		}
+	}
+
+	if len(parts) < len(prefix)+3 || !slices.Equal(parts[:len(prefix)], prefix) || parts[len(prefix)+1] != "outputs" {
+		return "", "", false
+	}
+	return parts[len(prefix)], parts[len(prefix)+2], true
+}
+
+// remoteStateSources maps names of `terraform_remote_state` data sources to producer stacks.
+// Backend config can't be matched to a stack reliably, so this is a heuristic: a stack is the producer,
+// if its path is a part of a literal string in the `config` (e.g. S3 key or local path).
+// The longest matching path wins.
+func remoteStateSources(root, stack string, body *hclsyntax.Body, producers []string) map[string]string {
+	res := make(map[string]string)
+	for _, block := range body.Blocks {
+		if block.Type != "data" || len(block.Labels) != 2 || block.Labels[0] != "terraform_remote_state" {
+			continue
+		}
+		attr := block.Body.Attributes["config"]
+		if attr == nil {
+			continue
+		}
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			continue
+		}
+
+		var strs []string
+		collectStrings(val, &strs)
+
+		best := ""
+		for _, s := range strs {
+			candidates := []string{"/" + strings.Trim(s, "/") + "/"}
+			if rel, ok := repoRelPath(root, stack, filepath.Dir(s)); ok {
+				// local backend, path to the state file relative to the stack
+				candidates = append(candidates, "/"+rel+"/")
+			}
+
+			for _, p := range producers {
+				for _, c := range candidates {
+					if strings.Contains(c, "/"+p+"/") && len(p) > len(best) {
+						best = p
+					}
+				}
+			}
+		}
+		if best != "" {
+			res[block.Labels[1]] = best
+		}
+	}
+	return res
+}
+
+func collectStrings(val cty.Value, res *[]string) {
+	if val.IsNull() || !val.IsKnown() {
+		return
+	}
+	switch {
+	case val.Type() == cty.String:
+		*res = append(*res, val.AsString())
+	case val.CanIterateElements():
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			collectStrings(v, res)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnnotateOutputConsumers(t *testing.T) {
+	root := t.TempDir()
+	for fname, content := range map[string]string{
+		"prod/vpc/main.tf": `output "vpc_id" { value = "vpc-1" }`,
+		"prod/eks/terragrunt.hcl": `dependency "vpc" {
+  config_path = "../vpc"
+}
+inputs = {
+  vpc_id = dependency.vpc.outputs.vpc_id
+}`,
+		"prod/app/main.tf": `data "terraform_remote_state" "network" {
+  backend = "s3"
+  config = {
+    bucket = "tf-state"
+    key    = "prod/vpc/terraform.tfstate"
+  }
+}
+locals {
+  subnets = data.terraform_remote_state.network.outputs["subnet_ids"]
+}`,
+		"prod/legacy/main.tf": `data "terraform_remote_state" "vpc" {
+  backend = "local"
+  config = {
+    path = "../vpc/terraform.tfstate"
+  }
+}
+locals {
+  vpc_id = data.terraform_remote_state.vpc.outputs.vpc_id
+}`,
+		// a prefix of the producer path in the state key, and a variable with the output name
+		"prod/dns/main.tf": `data "terraform_remote_state" "old" {
+  backend = "s3"
+  config = {
+    bucket = "tf-state"
+    key    = "prod/vpc-old/terraform.tfstate"
+  }
+}
+locals {
+  vpc_id  = data.terraform_remote_state.old.outputs.vpc_id
+  subnets = var.subnet_ids
+}`,
+		// caches are not stacks
+		"prod/eks/.terragrunt-cache/abc/main.tf": `locals {
+  vpc_id = data.terraform_remote_state.vpc.outputs.vpc_id
+}
+data "terraform_remote_state" "vpc" {
+  backend = "s3"
+  config = { key = "prod/vpc/terraform.tfstate" }
+}`,
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(fname)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, fname), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		scanRepo bool
+		want     map[string][]string
+	}{
+		{
+			name: "stacks of the PR",
+			want: map[string][]string{"vpc_id": {"prod/eks"}, "subnet_ids": {"prod/app"}},
+		},
+		{
+			name:     "whole repo",
+			scanRepo: true,
+			want:     map[string][]string{"vpc_id": {"prod/eks", "prod/legacy"}, "subnet_ids": {"prod/app"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vpc := uiStack{Path: "prod/vpc"}
+			vpc.OutputDiffs = []uiDiff{{Address: "vpc_id"}, {Address: "subnet_ids"}}
+			stacks := []uiStack{vpc, {Path: "prod/eks"}, {Path: "prod/app"}, {Path: "prod/dns"}}
+
+			if err := annotateOutputConsumers(root, stacks, tc.scanRepo); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string][]string)
+			for _, d := range stacks[0].OutputDiffs {
+				got[d.Address] = d.Consumers
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("consumers = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
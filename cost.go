@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	costMode     = flag.String("cost", "", `Add monthly cost estimation: "file" reads infracost.json next to plan.json, "infracost" runs infracost on plan.json, which sends resources to the Infracost pricing API`)
+	infracostBin = flag.String("infracost-bin", "infracost", "Path to the infracost binary for -cost=infracost")
+)
+
+// uiCost is a monthly cost estimation, values are decimal strings, as in Infracost output.
+type uiCost struct {
+	Currency        string `json:"currency"`
+	PastMonthlyCost string `json:"past_monthly_cost"`
+	MonthlyCost     string `json:"monthly_cost"`
+	DiffMonthlyCost string `json:"diff_monthly_cost"`
+}
+
+// infracostOutput is a subset of Infracost JSON output format, shared by `breakdown` and `diff` commands.
+type infracostOutput struct {
+	Currency             string  `json:"currency"`
+	TotalMonthlyCost     *string `json:"totalMonthlyCost"`
+	PastTotalMonthlyCost *string `json:"pastTotalMonthlyCost"`
+	DiffTotalMonthlyCost *string `json:"diffTotalMonthlyCost"`
+}
+
+// stackCost returns the cost estimation for the stack with plans in planDir, according to -cost flag.
+func stackCost(planDir string) (*uiCost, error) {
+	var data []byte
+	var err error
+
+	switch *costMode {
+	case "file":
+		// generated by the workflow, e.g. with `infracost breakdown --path plan.json --format json`
+		data, err = os.ReadFile(planDir + "infracost.json")
+	case "infracost":
+		cmd := exec.Command(*infracostBin, "breakdown", "--path", planDir+"plan.json", "--format", "json", "--log-level", "error")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		data, err = cmd.Output()
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	default:
+		return nil, fmt.Errorf("unknown -cost mode: %q", *costMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out infracostOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	past := parseCost(out.PastTotalMonthlyCost)
+	total := parseCost(out.TotalMonthlyCost)
+	diff := new(big.Rat).Sub(total, past)
+	if out.DiffTotalMonthlyCost != nil {
+		diff = parseCost(out.DiffTotalMonthlyCost)
+	}
+
+	return &uiCost{
+		Currency:        out.Currency,
+		PastMonthlyCost: past.FloatString(2),
+		MonthlyCost:     total.FloatString(2),
+		DiffMonthlyCost: diff.FloatString(2),
+	}, nil
+}
+
+// pullCost sums costs of all stacks, returns nil if there are no estimations,
+// or if stacks are estimated in different currencies, as there are no exchange rates to sum them.
+func pullCost(stacks []uiStack) *uiCost {
+	var res *uiCost
+	past, total, diff := new(big.Rat), new(big.Rat), new(big.Rat)
+	for _, s := range stacks {
+		if s.Cost == nil {
+			continue
+		}
+		if res == nil {
+			res = &uiCost{Currency: s.Cost.Currency}
+		}
+		if s.Cost.Currency != res.Currency {
+			slog.Warn("stacks are estimated in different currencies, skipping the total cost",
+				"currency", res.Currency, "stack", s.Path, "stack_currency", s.Cost.Currency)
+			return nil
+		}
+		past.Add(past, parseCost(&s.Cost.PastMonthlyCost))
+		total.Add(total, parseCost(&s.Cost.MonthlyCost))
+		diff.Add(diff, parseCost(&s.Cost.DiffMonthlyCost))
+	}
+	if res != nil {
+		res.PastMonthlyCost = past.FloatString(2)
+		res.MonthlyCost = total.FloatString(2)
+		res.DiffMonthlyCost = diff.FloatString(2)
+	}
+	return res
+}
+
+// parseCost parses a decimal cost string, null or malformed values are zero.
+func parseCost(s *string) *big.Rat {
+	r := new(big.Rat)
+	if s == nil {
+		return r
+	}
+	if _, ok := r.SetString(*s); !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// FormatDiff returns the cost difference with an explicit sign, e.g. "+12.30 USD".
+func (c uiCost) FormatDiff() string {
+	sign := ""
+	if !strings.HasPrefix(c.DiffMonthlyCost, "-") {
+		sign = "+"
+	}
+	return fmt.Sprintf("%s%s %s", sign, c.DiffMonthlyCost, c.Currency)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPullCost(t *testing.T) {
+	usd := func(past, total, diff string) *uiCost {
+		return &uiCost{Currency: "USD", PastMonthlyCost: past, MonthlyCost: total, DiffMonthlyCost: diff}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		costs []*uiCost
+		want  *uiCost
+	}{
+		{
+			name:  "no estimations",
+			costs: []*uiCost{nil, nil},
+		},
+		{
+			name:  "same currency",
+			costs: []*uiCost{usd("10.00", "15.50", "5.50"), nil, usd("3.00", "0.00", "-3.00")},
+			want:  usd("13.00", "15.50", "2.50"),
+		},
+		{
+			name:  "mixed currencies",
+			costs: []*uiCost{usd("10.00", "15.50", "5.50"), {Currency: "EUR", PastMonthlyCost: "1.00", MonthlyCost: "2.00", DiffMonthlyCost: "1.00"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stacks []uiStack
+			for _, c := range tc.costs {
+				stacks = append(stacks, uiStack{Path: "stack", Cost: c})
+			}
+			if got := pullCost(stacks); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("pullCost() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+var driftReport = flag.String("drift-report", "", "Write a drift report with the given name (e.g. repo name) from all plan.json/plan.txt pairs in -plans-dir and exit")
+
+// driftReportDir is the subdir of the output dir with drift reports, `drift.html#<name>` shows them.
+const driftReportDir = "drift"
+
+// driftReportData is a snapshot of all drift in a repo, produced from scheduled plans of the default branch.
+type driftReportData struct {
+	Name        string       `json:"name"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Stacks      []driftStack `json:"stacks"`
+}
+
+type driftStack struct {
+	Path string `json:"path"`
+
+	// ConversionError is set when the plan of the stack couldn't be parsed, drift of the stack is unknown then
+	ConversionError string `json:"conversion_error,omitempty"`
+
+	Drifts []driftResource `json:"drifts"`
+
+	// Resolved are resources which drifted in the previous report, but not anymore
+	Resolved []driftResource `json:"resolved,omitempty"`
+
+	// Removed is set when the stack had drift in the previous report, but has no plan in this one,
+	// all of its drift is listed as resolved then
+	Removed bool `json:"removed,omitempty"`
+}
+
+type driftResource struct {
+	Address string `json:"address"`
+	Diff    string `json:"diff,omitempty"`
+
+	// FirstSeen is the time of the first report the resource drifted in, carried over between reports
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// runDriftReport converts all plans in the plans dir, keeping all drift, and writes the report to the output dir.
+func runDriftReport(name string) error {
+	if *plansDir == "" || *outputDir == "" {
+		flag.Usage()
+		return fmt.Errorf("no -plans-dir or -output-dir specified")
+	}
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("invalid drift report name: %q", name)
+	}
+
+	fname := filepath.Join(*outputDir, driftReportDir, name+".json")
+	prev, err := readDriftReport(fname)
+	if err != nil {
+		return fmt.Errorf("failed to read previous report: %w", err)
+	}
+
+	stacks, err := findPlanDirs(*plansDir)
+	if err != nil {
+		return fmt.Errorf("failed to find plans: %w", err)
+	}
+	slog.Info("found plans", "count", len(stacks))
+
+	res := driftReportData{
+		Name:        name,
+		GeneratedAt: time.Now().UTC(),
+	}
+	for _, stack := range stacks {
+		res.Stacks = append(res.Stacks, convertDriftStack(stack, filepath.Join(*plansDir, stack)))
+	}
+	compareDriftReports(prev, &res)
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(fname, jsonData); err != nil {
+		return err
+	}
+	slog.Info("wrote drift report", "file", fname)
+	return nil
+}
+
+// findPlanDirs returns dirs with both plan.json and plan.txt, relative to root.
+func findPlanDirs(root string) ([]string, error) {
+	var res []string
+	err := walkFiles(root, func(path string, d fs.DirEntry) error {
+		if d.Name() != "plan.json" {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), "plan.txt")); err != nil {
+			slog.Warn("skipping plan without plan.txt", "file", path)
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		res = append(res, filepath.ToSlash(rel))
+		return nil
+	})
+	slices.Sort(res)
+	return res, err
+}
+
+func convertDriftStack(stack, planDir string) driftStack {
+	res := driftStack{Path: stack}
+
+	tfp, err := parseJSONPlan(filepath.Join(planDir, "plan.json"))
+	if err != nil {
+		slog.Warn("failed to parse JSON plan", "path", stack, "err", err)
+		res.ConversionError = fmt.Sprintf("failed to parse JSON plan: %v", err)
+		return res
+	}
+
+	txts, err := parseTextPlan(filepath.Join(planDir, "plan.txt"))
+	if err != nil {
+		slog.Warn("failed to parse text plan", "path", stack, "err", err)
+		res.ConversionError = fmt.Sprintf("failed to parse text plan: %v", err)
+		return res
+	}
+
+	for _, d := range convertStackPlan(tfp, txts).DriftDiffs {
+		res.Drifts = append(res.Drifts, driftResource{
+			Address: d.Address,
+			Diff:    d.Diff,
+		})
+	}
+	slices.SortFunc(res.Drifts, func(l, r driftResource) int {
+		return cmp.Compare(l.Address, r.Address)
+	})
+	return res
+}
+
+// readDriftReport reads the report, returning an empty one if it doesn't exist yet.
+func readDriftReport(fname string) (driftReportData, error) {
+	var res driftReportData
+	jsonData, err := os.ReadFile(fname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(jsonData, &res)
+	return res, err
+}
+
+// compareDriftReports carries first seen times over from the previous report and lists resolved drifts,
+// including drifts of stacks which are not in the current report anymore.
+func compareDriftReports(prev driftReportData, cur *driftReportData) {
+	prevStacks := make(map[string]driftStack)
+	for _, s := range prev.Stacks {
+		prevStacks[s.Path] = s
+	}
+
+	for i := range cur.Stacks {
+		s := &cur.Stacks[i]
+		p, ok := prevStacks[s.Path]
+		delete(prevStacks, s.Path)
+		if !ok {
+			for j := range s.Drifts {
+				s.Drifts[j].FirstSeen = cur.GeneratedAt
+			}
+			continue
+		}
+
+		if s.ConversionError != "" {
+			// drift is unknown, keep the previous one, so that first seen times are not lost
+			s.Drifts = p.Drifts
+			continue
+		}
+
+		prevDrifts := make(map[string]driftResource)
+		for _, d := range p.Drifts {
+			prevDrifts[d.Address] = d
+		}
+
+		for j := range s.Drifts {
+			d := &s.Drifts[j]
+			d.FirstSeen = cur.GeneratedAt
+			if pd, ok := prevDrifts[d.Address]; ok {
+				d.FirstSeen = pd.FirstSeen
+				delete(prevDrifts, d.Address)
+			}
+		}
+
+		for _, d := range prevDrifts {
+			d.Diff = ""
+			s.Resolved = append(s.Resolved, d)
+		}
+		slices.SortFunc(s.Resolved, func(l, r driftResource) int {
+			return cmp.Compare(l.Address, r.Address)
+		})
+	}
+
+	for _, p := range prevStacks {
+		if len(p.Drifts) == 0 {
+			continue
+		}
+		s := driftStack{Path: p.Path, Removed: true}
+		for _, d := range p.Drifts {
+			d.Diff = ""
+			s.Resolved = append(s.Resolved, d)
+		}
+		cur.Stacks = append(cur.Stacks, s)
+	}
+	slices.SortFunc(cur.Stacks, func(l, r driftStack) int {
+		return cmp.Compare(l.Path, r.Path)
+	})
+}
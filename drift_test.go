@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareDriftReports(t *testing.T) {
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := before.Add(24 * time.Hour)
+	drift := func(addr string, firstSeen time.Time) driftResource {
+		return driftResource{Address: addr, Diff: "diff of " + addr, FirstSeen: firstSeen}
+	}
+	resolved := func(addr string, firstSeen time.Time) driftResource {
+		return driftResource{Address: addr, FirstSeen: firstSeen}
+	}
+
+	for _, tc := range []struct {
+		name string
+		prev []driftStack
+		cur  []driftStack
+		want []driftStack
+	}{
+		{
+			name: "first report",
+			cur:  []driftStack{{Path: "vpc", Drifts: []driftResource{drift("a", time.Time{})}}},
+			want: []driftStack{{Path: "vpc", Drifts: []driftResource{drift("a", now)}}},
+		},
+		{
+			name: "first seen is carried over",
+			prev: []driftStack{{Path: "vpc", Drifts: []driftResource{drift("a", before)}}},
+			cur:  []driftStack{{Path: "vpc", Drifts: []driftResource{drift("a", time.Time{}), drift("b", time.Time{})}}},
+			want: []driftStack{{Path: "vpc", Drifts: []driftResource{drift("a", before), drift("b", now)}}},
+		},
+		{
+			name: "resolved drift",
+			prev: []driftStack{{Path: "vpc", Drifts: []driftResource{drift("a", before), drift("b", before)}}},
+			cur:  []driftStack{{Path: "vpc", Drifts: []driftResource{drift("b", time.Time{})}}},
+			want: []driftStack{{Path: "vpc", Drifts: []driftResource{drift("b", before)}, Resolved: []driftResource{resolved("a", before)}}},
+		},
+		{
+			name: "stack failed to convert keeps previous drift",
+			prev: []driftStack{{Path: "vpc", Drifts: []driftResource{drift("a", before)}}},
+			cur:  []driftStack{{Path: "vpc", ConversionError: "failed to parse JSON plan"}},
+			want: []driftStack{{Path: "vpc", ConversionError: "failed to parse JSON plan", Drifts: []driftResource{drift("a", before)}}},
+		},
+		{
+			name: "stack without a plan has its drift resolved",
+			prev: []driftStack{
+				{Path: "clean"},
+				{Path: "old", Drifts: []driftResource{drift("a", before)}},
+				{Path: "vpc", Drifts: []driftResource{drift("b", before)}},
+			},
+			cur: []driftStack{{Path: "vpc", Drifts: []driftResource{drift("b", time.Time{})}}},
+			want: []driftStack{
+				{Path: "old", Removed: true, Resolved: []driftResource{resolved("a", before)}},
+				{Path: "vpc", Drifts: []driftResource{drift("b", before)}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cur := driftReportData{GeneratedAt: now, Stacks: tc.cur}
+			compareDriftReports(driftReportData{GeneratedAt: before, Stacks: tc.prev}, &cur)
+			if !reflect.DeepEqual(cur.Stacks, tc.want) {
+				t.Errorf("stacks = %+v, want %+v", cur.Stacks, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// hashedSnapshotRe matches immutable snapshot files, `<pull>_<hash>.json`.
+var hashedSnapshotRe = regexp.MustCompile(`^(.+)_([0-9a-f]{32})\.json$`)
+
+type snapshotEvent struct {
+	// Snapshot is the namespaced snapshot name, as used in viewer URLs, see snapshotID
+	Snapshot string `json:"snapshot"`
+	Hash     string `json:"hash"`
+}
+
+// snapshotWatcher watches the output dir for new snapshots and fans out events to subscribers.
+type snapshotWatcher struct {
+	root    string
+	watcher *fsnotify.Watcher
+
+	mu       sync.Mutex
+	subs     map[chan snapshotEvent]struct{}
+	lastHash map[string]string
+
+	// done is closed on shutdown to end event streams
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSnapshotWatcher(root string) (*snapshotWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &snapshotWatcher{
+		root:     root,
+		watcher:  watcher,
+		subs:     make(map[chan snapshotEvent]struct{}),
+		lastHash: make(map[string]string),
+		done:     make(chan struct{}),
+	}
+
+	// fsnotify is not recursive, snapshots are namespaced in nested dirs
+	if err := w.addTree(root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go w.loop()
+	return w, nil
+}
+
+func (w *snapshotWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+func (w *snapshotWatcher) loop() {
+	for {
+		select {
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(ev)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("snapshot watcher error", "err", err)
+		}
+	}
+}
+
+func (w *snapshotWatcher) handle(ev fsnotify.Event) {
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		w.forget(ev.Name)
+		return
+	}
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return
+	}
+
+	if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
+		// new repo or host dir, files might be already written before we started watching it
+		if err := w.addTree(ev.Name); err != nil {
+			slog.Warn("failed to watch dir", "dir", ev.Name, "err", err)
+		}
+		_ = filepath.WalkDir(ev.Name, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				w.handleFile(path)
+			}
+			return nil
+		})
+		return
+	}
+
+	w.handleFile(ev.Name)
+}
+
+func (w *snapshotWatcher) handleFile(path string) {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return
+	}
+
+	m := hashedSnapshotRe.FindStringSubmatch(filepath.ToSlash(rel))
+	if m == nil {
+		return
+	}
+	ev := snapshotEvent{Snapshot: m[1], Hash: m[2]}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// a single file write produces several fs events
+	if w.lastHash[ev.Snapshot] == ev.Hash {
+		return
+	}
+	w.lastHash[ev.Snapshot] = ev.Hash
+
+	for ch := range w.subs {
+		select {
+		case ch <- ev:
+		default:
+			// slow client, it will get the next one
+		}
+	}
+}
+
+// forget drops last hashes of snapshots at path, a removed snapshot file or a whole removed dir,
+// so that lastHash doesn't grow with every PR ever planned when old snapshots are cleaned up.
+func (w *snapshotWatcher) forget(path string) {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if m := hashedSnapshotRe.FindStringSubmatch(rel); m != nil {
+		// removing an older snapshot of the PR keeps the hash of the latest one
+		if w.lastHash[m[1]] == m[2] {
+			delete(w.lastHash, m[1])
+		}
+		return
+	}
+	for snapshot := range w.lastHash {
+		if strings.HasPrefix(snapshot, rel+"/") {
+			delete(w.lastHash, snapshot)
+		}
+	}
+}
+
+// close stops watching and ends all event streams, viewers reconnect to another server.
+func (w *snapshotWatcher) close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.watcher.Close()
+	})
+}
+
+func (w *snapshotWatcher) subscribe() chan snapshotEvent {
+	ch := make(chan snapshotEvent, 16)
+	w.mu.Lock()
+	w.subs[ch] = struct{}{}
+	w.mu.Unlock()
+	return ch
+}
+
+func (w *snapshotWatcher) unsubscribe(ch chan snapshotEvent) {
+	w.mu.Lock()
+	delete(w.subs, ch)
+	w.mu.Unlock()
+}
+
+// ServeHTTP streams new snapshots as server-sent events.
+// Optional `snapshot` query param limits events to a single PR.
+func (w *snapshotWatcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := strings.Trim(r.URL.Query().Get("snapshot"), "/")
+
+	ch := w.subscribe()
+	defer w.unsubscribe(ch)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	// disable buffering in nginx, otherwise events are delayed
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// keep connection alive through proxies with idle timeouts
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-w.done:
+			return
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case ev := <-ch:
+			if filter != "" && ev.Snapshot != filter {
+				continue
+			}
+
+			data, err := json.Marshal(ev)
+			if err != nil {
+				slog.Error("failed to marshal snapshot event", "err", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(rw, "event: snapshot\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
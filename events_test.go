@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotWatcher(t *testing.T) {
+	old := *outputDir
+	*outputDir = t.TempDir()
+	defer func() { *outputDir = old }()
+
+	w, err := newSnapshotWatcher(*outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+	ch := w.subscribe()
+	defer w.unsubscribe(ch)
+
+	data := uiData{VCSHost: "github.com", PRRepo: "org/infra", PRNum: 7}
+	hash, err := writeUIData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-ch:
+		want := snapshotEvent{Snapshot: "github.com/org/infra/7", Hash: hash}
+		if ev != want {
+			t.Errorf("event = %+v, want %+v", ev, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for the new snapshot")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(*outputDir, "github.com", "org", "infra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if len(names) != 2 {
+		t.Errorf("files in the output dir = %v, want the snapshot and its hashed copy only", names)
+	}
+
+	// cleanup of old snapshots, e.g. by a cron job
+	if err := os.RemoveAll(filepath.Join(*outputDir, "github.com", "org")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		n := len(w.lastHash)
+		w.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lastHash has %d entries after snapshots were removed", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
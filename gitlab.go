@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var gitlabDiscussions = flag.Bool("gitlab-discussions", false, "On GitLab, post the comment as a resolvable MR discussion, updated in place on replans and resolved when there are no deletes or replacements")
+
+// gitlabDiscussionMarker tells the discussion of atlantis-plan-ui apart from other discussions in the MR.
+const gitlabDiscussionMarker = "<!-- atlantis-plan-ui -->"
+
+// gitlabPoster posts the comment as a single MR discussion through the GitLab API,
+// as the Atlantis VCS client can only create flat notes.
+type gitlabPoster struct {
+	// baseURL is the GitLab URL without the API path, e.g. https://gitlab.com
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// getGitlabPoster creates the poster with the GitLab host and token from the Atlantis config.
+func getGitlabPoster() (*gitlabPoster, error) {
+	userConfig, err := getAtlantisUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	if userConfig.GitlabToken == "" {
+		return nil, fmt.Errorf("no GitLab token in Atlantis config")
+	}
+
+	// same defaults as in Atlantis GitLab client
+	baseURL := userConfig.GitlabHostname
+	if baseURL == "" {
+		baseURL = "gitlab.com"
+	}
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "https://" + baseURL
+	}
+
+	return &gitlabPoster{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   userConfig.GitlabToken,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// fetchGitlabMRAuthor returns the username of the MR author, baseURL is the GitLab URL without the API path.
+func fetchGitlabMRAuthor(baseURL, token, repo, mr string) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("no GitLab token")
+	}
+	p := &gitlabPoster{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	var res struct {
+		Author struct {
+			Username string `json:"username"`
+		} `json:"author"`
+	}
+	if err := p.do(http.MethodGet, fmt.Sprintf("/projects/%s/merge_requests/%s", url.PathEscape(repo), mr), nil, &res); err != nil {
+		return "", err
+	}
+	return res.Author.Username, nil
+}
+
+type gitlabNote struct {
+	ID   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+type gitlabDiscussion struct {
+	ID    string       `json:"id"`
+	Notes []gitlabNote `json:"notes"`
+}
+
+// postDiscussion creates or updates the discussion in the MR, and resolves or reopens it.
+func (p *gitlabPoster) postDiscussion(repo string, mr int, body string, resolved bool) error {
+	body = gitlabDiscussionMarker + "\n" + body
+	mrPath := fmt.Sprintf("/projects/%s/merge_requests/%d", url.PathEscape(repo), mr)
+
+	discussion, err := p.findDiscussion(mrPath)
+	if err != nil {
+		return fmt.Errorf("failed to find discussion: %w", err)
+	}
+
+	if discussion == nil {
+		var created gitlabDiscussion
+		if err := p.do(http.MethodPost, mrPath+"/discussions", map[string]string{"body": body}, &created); err != nil {
+			return fmt.Errorf("failed to create discussion: %w", err)
+		}
+		discussion = &created
+	} else {
+		notePath := fmt.Sprintf("%s/discussions/%s/notes/%d", mrPath, discussion.ID, discussion.Notes[0].ID)
+		if err := p.do(http.MethodPut, notePath, map[string]string{"body": body}, nil); err != nil {
+			return fmt.Errorf("failed to update discussion: %w", err)
+		}
+	}
+
+	// reopened on replans with destructive changes, as the previous review doesn't cover them
+	resolvePath := fmt.Sprintf("%s/discussions/%s", mrPath, discussion.ID)
+	if err := p.do(http.MethodPut, resolvePath, map[string]bool{"resolved": resolved}, nil); err != nil {
+		return fmt.Errorf("failed to resolve discussion: %w", err)
+	}
+	return nil
+}
+
+// findDiscussion returns the discussion started by the marked note, or nil if there is none yet.
+func (p *gitlabPoster) findDiscussion(mrPath string) (*gitlabDiscussion, error) {
+	for page := "1"; page != ""; {
+		var discussions []gitlabDiscussion
+		resp, err := p.request(http.MethodGet, mrPath+"/discussions?per_page=100&page="+page, nil, &discussions)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range discussions {
+			if len(d.Notes) > 0 && strings.HasPrefix(d.Notes[0].Body, gitlabDiscussionMarker) {
+				return &d, nil
+			}
+		}
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return nil, nil
+}
+
+func (p *gitlabPoster) do(method, path string, body, out any) error {
+	_, err := p.request(method, path, body, out)
+	return err
+}
+
+// request calls the GitLab API and decodes the JSON response into out, if it's not nil.
+func (p *gitlabPoster) request(method, path string, body, out any) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, p.baseURL+"/api/v4"+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", p.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp, fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+		}
+	}
+	return resp, nil
+}
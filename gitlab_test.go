@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGitlabPosterPostDiscussion(t *testing.T) {
+	const mrPath = "/api/v4/projects/group%2Finfra/merge_requests/7"
+	other := gitlabDiscussion{ID: "other", Notes: []gitlabNote{{ID: 1, Body: "LGTM"}}}
+	ours := gitlabDiscussion{ID: "ours", Notes: []gitlabNote{{ID: 2, Body: gitlabDiscussionMarker + "\nold plan"}}}
+
+	type request struct {
+		Method string
+		Path   string
+		Body   string
+	}
+
+	for _, tc := range []struct {
+		name     string
+		pages    [][]gitlabDiscussion
+		resolved bool
+		want     []request
+	}{
+		{
+			name:  "first plan creates the discussion",
+			pages: [][]gitlabDiscussion{{other}},
+			want: []request{
+				{Method: "GET", Path: mrPath + "/discussions?per_page=100&page=1"},
+				{Method: "POST", Path: mrPath + "/discussions", Body: `{"body":"\u003c!-- atlantis-plan-ui --\u003e\nnew plan"}`},
+				{Method: "PUT", Path: mrPath + "/discussions/created", Body: `{"resolved":false}`},
+			},
+		},
+		{
+			name:     "replan updates the discussion from the second page and resolves it",
+			pages:    [][]gitlabDiscussion{{other}, {ours}},
+			resolved: true,
+			want: []request{
+				{Method: "GET", Path: mrPath + "/discussions?per_page=100&page=1"},
+				{Method: "GET", Path: mrPath + "/discussions?per_page=100&page=2"},
+				{Method: "PUT", Path: mrPath + "/discussions/ours/notes/2", Body: `{"body":"\u003c!-- atlantis-plan-ui --\u003e\nnew plan"}`},
+				{Method: "PUT", Path: mrPath + "/discussions/ours", Body: `{"resolved":true}`},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []request
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if token := r.Header.Get("PRIVATE-TOKEN"); token != "secret" {
+					t.Errorf("%s %s: token %q, want %q", r.Method, r.URL, token, "secret")
+				}
+				body, _ := io.ReadAll(r.Body)
+				path := r.URL.EscapedPath()
+				if r.URL.RawQuery != "" {
+					path += "?" + r.URL.RawQuery
+				}
+				got = append(got, request{Method: r.Method, Path: path, Body: string(body)})
+
+				switch {
+				case r.Method == http.MethodGet:
+					page := 0
+					if p := r.URL.Query().Get("page"); p == "2" {
+						page = 1
+					}
+					if page+1 < len(tc.pages) {
+						w.Header().Set("X-Next-Page", "2")
+					}
+					json.NewEncoder(w).Encode(tc.pages[page])
+				case r.Method == http.MethodPost:
+					json.NewEncoder(w).Encode(gitlabDiscussion{ID: "created", Notes: []gitlabNote{{ID: 3}}})
+				default:
+					w.Write([]byte("{}"))
+				}
+			}))
+			defer srv.Close()
+
+			p := &gitlabPoster{baseURL: srv.URL, token: "secret", client: srv.Client()}
+			if err := p.postDiscussion("group/infra", 7, "new plan", tc.resolved); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("requests = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGitlabPosterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"403 Forbidden"}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	p := &gitlabPoster{baseURL: srv.URL, token: "secret", client: srv.Client()}
+	if err := p.postDiscussion("group/infra", 7, "new plan", false); err == nil {
+		t.Error("postDiscussion() succeeded on a forbidden response")
+	}
+}
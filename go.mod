@@ -3,10 +3,15 @@ module github.com/ilyaluk/atlantis-plan-ui
 go 1.23.0
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/hashicorp/hcl/v2 v2.21.0
+	github.com/prometheus/client_golang v1.12.1
 	github.com/runatlantis/atlantis v0.29.0
 	github.com/spf13/viper v1.19.0
+	github.com/zclconf/go-cty v1.14.4
 	go.etcd.io/bbolt v1.3.11
 	golang.org/x/net v0.26.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -29,7 +34,6 @@ require (
 	github.com/davidmz/go-pageant v1.0.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/fatih/color v1.16.0 // indirect
-	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.3 // indirect
 	github.com/go-fed/httpsig v1.1.0 // indirect
 	github.com/go-ozzo/ozzo-validation v3.6.0+incompatible // indirect
@@ -57,7 +61,6 @@ require (
 	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
 	github.com/hashicorp/hc-install v0.8.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
-	github.com/hashicorp/hcl/v2 v2.21.0 // indirect
 	github.com/hashicorp/terraform-config-inspect v0.0.0-20240801114854-6714b46f5fe4 // indirect
 	github.com/huandu/xstrings v1.4.0 // indirect
 	github.com/imdario/mergo v0.3.16 // indirect
@@ -81,7 +84,6 @@ require (
 	github.com/moby/patternmatcher v0.6.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/prometheus/client_golang v1.12.1 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.34.0 // indirect
 	github.com/prometheus/procfs v0.10.1 // indirect
@@ -104,7 +106,6 @@ require (
 	github.com/ulikunitz/xz v0.5.11 // indirect
 	github.com/urfave/negroni/v3 v3.1.1 // indirect
 	github.com/xanzy/go-gitlab v0.107.0 // indirect
-	github.com/zclconf/go-cty v1.14.4 // indirect
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
@@ -121,5 +122,4 @@ require (
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// healthz reports that the server is up, without touching the UI or the output dir.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+// readyz reports whether the output dir with snapshots is readable, e.g. the shared volume is mounted.
+func readyz(w http.ResponseWriter, _ *http.Request) {
+	f, err := os.Open(*outputDir)
+	if err == nil {
+		_, err = f.ReadDir(1)
+		f.Close()
+		if err == io.EOF {
+			// empty dir is fine, there are no snapshots yet
+			err = nil
+		}
+	}
+	if err != nil {
+		http.Error(w, "output dir is not readable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	// Module is the main module version, set by go install
+	Module string `json:"module,omitempty"`
+	// Revision, RevisionTime and Modified are VCS info of the build
+	Revision     string `json:"revision,omitempty"`
+	RevisionTime string `json:"revision_time,omitempty"`
+	Modified     bool   `json:"modified,omitempty"`
+	// UIHash is the hash of the served UI assets, to check which frontend the server has
+	UIHash string `json:"ui_hash"`
+}
+
+func getVersionInfo(uiFS fs.FS) (versionInfo, error) {
+	res := versionInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		res.Module = info.Main.Version
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				res.Revision = s.Value
+			case "vcs.time":
+				res.RevisionTime = s.Value
+			case "vcs.modified":
+				res.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	var err error
+	res.UIHash, err = hashFS(uiFS)
+	return res, err
+}
+
+// hashFS returns the hash of paths and contents of all files in fsys, walked in lexical order.
+func hashFS(fsys fs.FS) (string, error) {
+	h := sha256.New()
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		// separators, so that moving bytes between a path and its content changes the hash
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write(data)
+		h.Write([]byte{0})
+		return nil
+	})
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+func versionHandler(info versionInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(info)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	localDir     = flag.String("local", "", "Build the viewer from plans in the dir without Atlantis: plan.json/plan.txt pairs, or *.tfplan files shown with -terraform-bin")
+	terraformBin = flag.String("terraform-bin", "terraform", "Terraform or OpenTofu executable to show *.tfplan files with")
+)
+
+// localHost is the VCS host part of local snapshot names, see snapshotID.
+const localHost = "local"
+
+// runLocal converts plans in -local dir, writes the snapshot to -output-dir, and serves it if -serve is specified.
+func runLocal() error {
+	if *outputDir == "" && *serve == "" {
+		flag.Usage()
+		return fmt.Errorf("no -output-dir or -serve specified")
+	}
+
+	root, err := filepath.Abs(*localDir)
+	if err != nil {
+		return err
+	}
+
+	if *outputDir == "" {
+		*outputDir, err = os.MkdirTemp("", "atlantis-plan-ui-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(*outputDir)
+	}
+
+	stacks, err := findLocalPlans(root)
+	if err != nil {
+		return fmt.Errorf("failed to find plans: %w", err)
+	}
+	if len(stacks) == 0 {
+		return fmt.Errorf("no plan.json/plan.txt pairs or *.tfplan files found in %s", root)
+	}
+	slog.Info("found plans", "count", len(stacks))
+
+	// -vcs-repo and -vcs-pull are optional here, to tell apart snapshots of several branches or CI runs
+	cs := changeSet{
+		VCSHost: localHost,
+		Repo:    *vcsRepo,
+		Num:     *vcsPull,
+		Stacks:  stacks,
+	}
+	if cs.Repo == "" {
+		cs.Repo = filepath.Base(root)
+	}
+	res := convertChangeSet(cs)
+
+	hash, err := writeUIData(res)
+	if err != nil {
+		return fmt.Errorf("failed to write UI data: %w", err)
+	}
+	id := snapshotID(res.VCSHost, res.PRRepo, res.PRNum)
+	slog.Info("wrote UI data", "file", filepath.Join(*outputDir, id+".json"), "hash", hash)
+
+	if *serve == "" {
+		return nil
+	}
+
+	addr := *serve
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	scheme := "http://"
+	if *tlsCert != "" {
+		scheme = "https://"
+	}
+	slog.Info("open viewer", "url", snapshotURL(scheme+addr+strings.TrimRight(*servePath, "/")+"/", res, hash))
+	return runServe(*serve)
+}
+
+// findLocalPlans returns stacks with plan.json/plan.txt pairs and *.tfplan files in root, pairs take precedence in the same dir.
+func findLocalPlans(root string) ([]changeSetStack, error) {
+	dirs, err := findPlanDirs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []changeSetStack
+	for _, dir := range dirs {
+		res = append(res, changeSetStack{Path: dir, PlanDir: filepath.Join(root, dir)})
+	}
+
+	err = walkFiles(root, func(path string, d fs.DirEntry) error {
+		if !strings.HasSuffix(d.Name(), ".tfplan") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.Contains(dirs, rel) {
+			return nil
+		}
+		res = append(res, changeSetStack{
+			// several plans in the same dir are told apart by name, e.g. workspaces
+			Name:     strings.TrimSuffix(d.Name(), ".tfplan"),
+			Path:     rel,
+			PlanFile: path,
+		})
+		return nil
+	})
+	return res, err
+}
+
+// showPlanFile writes plan.json and plan.txt of the binary plan to dir.
+func showPlanFile(planFile, dir string) error {
+	for fname, args := range map[string][]string{
+		"plan.json": {"show", "-json", planFile},
+		"plan.txt":  {"show", "-no-color", planFile},
+	} {
+		// terraform needs initialized providers, so it runs in the stack dir
+		if err := showPlan(filepath.Dir(planFile), args, filepath.Join(dir, fname)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showPlan runs terraform in dir and writes the output to fname.
+func showPlan(dir string, args []string, fname string) error {
+	out, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := exec.Command(*terraformBin, args...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Close()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/runatlantis/atlantis/server/logging"
+)
+
+var (
+	logFormat = flag.String("log-format", "text", "Log format: text or json")
+	logLevel  = flag.String("log-level", "info", "Log level: debug, info, warn or error, also applied to Atlantis internals")
+)
+
+// runID identifies the process in every log line and in snapshots it writes,
+// so that a viewer URL can be traced back to the logs of the hook run.
+var runID = newRunID()
+
+// parsedLogLevel is -log-level, set by setupLogging.
+var parsedLogLevel = slog.LevelInfo
+
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// setupLogging sets the default slog logger from -log-format and -log-level, the standard log package is redirected to it too.
+func setupLogging() error {
+	if err := parsedLogLevel.UnmarshalText([]byte(*logLevel)); err != nil {
+		return fmt.Errorf("invalid -log-level: %w", err)
+	}
+
+	opts := &slog.HandlerOptions{Level: parsedLogLevel}
+	var handler slog.Handler
+	switch *logFormat {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid -log-format %q, must be text or json", *logFormat)
+	}
+
+	slog.SetDefault(slog.New(handler).With("run_id", runID))
+	return nil
+}
+
+// stackLogger returns the logger with fields of the stack.
+func stackLogger(stack uiStack) *slog.Logger {
+	return slog.With("project", stack.Name, "path", stack.Path, "workspace", stack.Workspace)
+}
+
+// atlantisLogLevel returns the Atlantis log level and its flag value matching -log-level.
+func atlantisLogLevel() (logging.LogLevel, string) {
+	switch {
+	case parsedLogLevel <= slog.LevelDebug:
+		return logging.Debug, "debug"
+	case parsedLogLevel <= slog.LevelInfo:
+		return logging.Info, "info"
+	case parsedLogLevel <= slog.LevelWarn:
+		return logging.Warn, "warn"
+	default:
+		return logging.Error, "error"
+	}
+}
+
+// fatal logs the error and exits, so that failed runs can be found by the run ID too.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
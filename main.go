@@ -9,13 +9,17 @@ import (
 	"fmt"
 	"golang.org/x/net/html"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
 	"slices"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/runatlantis/atlantis/server/events/models"
 	"go.etcd.io/bbolt"
@@ -31,6 +35,7 @@ var (
 
 	plansDir  = flag.String("plans-dir", "", "Directory containing processed source plan files")
 	outputDir = flag.String("output-dir", "", "Output directory for the generated JSON files")
+	workers   = flag.Int("workers", runtime.NumCPU(), "Number of stacks to convert in parallel")
 
 	postComment = flag.Bool("post-comment", true, "Post comment to the VCS with link to the generated UI")
 	uiURL       = flag.String("plan-ui-url", "", "URL of the atlantis-plan-ui server")
@@ -39,83 +44,137 @@ var (
 )
 
 func run() error {
-	if *vcsRepo == "" || *vcsPull == 0 {
+	start := time.Now()
+	if *outputDir == "" {
 		flag.Usage()
-		return fmt.Errorf("no -vcs-repo or -vcs-pull specified")
+		return fmt.Errorf("no -output-dir specified")
 	}
 
-	if *plansDir == "" || *outputDir == "" {
+	if *postComment && *uiURL == "" {
 		flag.Usage()
-		return fmt.Errorf("no -plans-dir or -output-dir specified")
+		return fmt.Errorf("no -plan-ui-url specified, consider using -post-comment=false")
 	}
 
-	if *postComment && *uiURL == "" {
+	if *approvalStatus && *uiURL == "" {
 		flag.Usage()
-		return fmt.Errorf("no -plan-ui-url specified, consider using -post-comment=false")
+		return fmt.Errorf("no -plan-ui-url specified, it's required for -approval-status")
 	}
 
 	if err := os.MkdirAll(*outputDir, 0755); err != nil {
 		return err
 	}
 
-	flags, err := getAtlantisFlags()
-	if err != nil {
-		return fmt.Errorf("failed to get Atlantis flags: %w", err)
+	var notifyCfg notifyConfigFile
+	var err error
+	if *notifyConfig != "" {
+		notifyCfg, err = loadNotifyConfig(*notifyConfig)
+		if err != nil {
+			return fmt.Errorf("failed to load notify config: %w", err)
+		}
 	}
-	log.Printf("got Atlantis flags: %+v", flags)
 
 	var commenter *commentPoster
-	if *postComment {
+	if *postComment || *approvalStatus {
 		commenter, err = getCommentPoster()
 		if err != nil {
 			return fmt.Errorf("failed to get comment poster: %w", err)
 		}
-		log.Println("got comment poster")
+		slog.Debug("got comment poster")
 	}
 
-	db, err := getAtlantisDB(flags.AtlantisDB)
-	if err != nil {
-		return fmt.Errorf("failed to open Atlantis DB: %w", err)
+	var discussionPoster *gitlabPoster
+	if *postComment && *gitlabDiscussions {
+		discussionPoster, err = getGitlabPoster()
+		if err != nil {
+			return fmt.Errorf("failed to get GitLab poster: %w", err)
+		}
 	}
-	defer db.Close()
-	log.Println("opened Atlantis DB")
 
-	pull, err := getPull(db, *vcsRepo, *vcsPull)
+	cs, err := loadChangeSet()
 	if errors.Is(err, pullNotFound) {
-		log.Println("pull not found, probably no stacks affected")
+		slog.Info("pull not found, probably no stacks affected")
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to get pull info: %w", err)
+		return fmt.Errorf("failed to load change set: %w", err)
 	}
-	log.Printf("got pull info: %s#%d", pull.Pull.BaseRepo.FullName, pull.Pull.Num)
+	// every following line is about this PR
+	slog.SetDefault(slog.With("repo", cs.Repo, "pull", cs.Num))
+	slog.Info("loaded change set", "stacks", len(cs.Stacks))
 
-	data, err := convertPull(db, flags, pull)
-	if err != nil {
-		return fmt.Errorf("failed to convert pull to UI: %w", err)
-	}
-	log.Println("converted pull to UI")
+	data := convertChangeSet(cs)
+	slog.Debug("converted change set to UI")
+	defer writeRunMetrics(data, start)
 
 	hash, err := writeUIData(data)
 	if err != nil {
 		return fmt.Errorf("failed to write UI data: %w", err)
 	}
-	log.Printf("wrote UI data")
+	slog.SetDefault(slog.With("hash", hash))
+	slog.Info("wrote UI data")
+
+	if len(notifyCfg.Sinks) > 0 {
+		viewerURL := ""
+		if *uiURL != "" {
+			viewerURL = snapshotURL(*uiURL, data, hash)
+		}
+		notify(notifyCfg, data, viewerURL)
+	}
+
+	var acks []ack
+	acksFetched := false
+	if *commentAcks || *approvalStatus {
+		acks, err = fetchAcks(snapshotID(data.VCSHost, data.PRRepo, data.PRNum))
+		if err != nil {
+			// acks are not essential, the approval stays pending without them
+			slog.Warn("failed to fetch acks", "err", err)
+		} else {
+			acksFetched = true
+		}
+	}
+
+	if *approvalStatus {
+		// new commit needs its own status, otherwise the required check never shows up
+		if err := commenter.updateApprovalStatus(data, acks, snapshotURL(*uiURL, data, hash)); err != nil {
+			return fmt.Errorf("failed to update approval status: %w", err)
+		}
+		slog.Info("updated approval status")
+	}
 
 	if !*postComment {
-		log.Println("skipping comment posting as requested")
+		slog.Info("skipping comment posting as requested")
 		return nil
 	}
 
-	comment, err := renderComment(data, hash)
+	var reviewed *reviewProgress
+	if *commentAcks && acksFetched {
+		progress := getReviewProgress(data, acks)
+		reviewed = &progress
+	}
+
+	comment, err := renderComment(data, hash, reviewed)
 	if err != nil {
 		return fmt.Errorf("failed to render comment: %w", err)
 	}
 
-	if err := commenter.postComment(pull.Pull.BaseRepo, pull.Pull.Num, comment); err != nil {
+	if discussionPoster != nil && data.VCSType == models.Gitlab.String() {
+		// deletes and replacements need a review, so the discussion stays open for them, and for stacks failed to plan
+		resolved := getApproval(data, nil).clean()
+		if err := discussionPoster.postDiscussion(data.PRRepo, data.PRNum, comment, resolved); err != nil {
+			return fmt.Errorf("failed to post discussion: %w", err)
+		}
+		slog.Info("posted discussion")
+		return nil
+	}
+
+	repo, err := snapshotRepo(data)
+	if err != nil {
+		return fmt.Errorf("failed to get repo to comment on: %w", err)
+	}
+	if err := commenter.postComment(repo, data.PRNum, comment); err != nil {
 		return fmt.Errorf("failed to post comment: %w", err)
 	}
-	log.Printf("posted comment")
+	slog.Info("posted comment")
 	return nil
 }
 
@@ -168,79 +227,279 @@ func getPull(db *bbolt.DB, repo string, num int) (models.PullStatus, error) {
 	return pull, err
 }
 
-func convertPull(db *bbolt.DB, flags *atlantisFlags, pull models.PullStatus) (uiData, error) {
-	res := uiData{
+// loadAtlantisChangeSet reads the pull from the Atlantis DB, plans are read from -plans-dir.
+func loadAtlantisChangeSet() (changeSet, error) {
+	if *vcsRepo == "" || *vcsPull == 0 {
+		flag.Usage()
+		return changeSet{}, fmt.Errorf("no -vcs-repo or -vcs-pull specified")
+	}
+
+	if *plansDir == "" {
+		flag.Usage()
+		return changeSet{}, fmt.Errorf("no -plans-dir specified")
+	}
+
+	flags, err := getAtlantisFlags()
+	if err != nil {
+		return changeSet{}, fmt.Errorf("failed to get Atlantis flags: %w", err)
+	}
+	slog.Debug("got Atlantis flags", "flags", flags)
+
+	db, err := getAtlantisDB(flags.AtlantisDB)
+	if err != nil {
+		return changeSet{}, fmt.Errorf("failed to open Atlantis DB: %w", err)
+	}
+	defer db.Close()
+	slog.Debug("opened Atlantis DB")
+
+	pull, err := getPull(db, *vcsRepo, *vcsPull)
+	if err != nil {
+		return changeSet{}, err
+	}
+	slog.Debug("got pull info", "repo", pull.Pull.BaseRepo.FullName, "pull", pull.Pull.Num)
+
+	return atlantisChangeSet(db, flags, pull)
+}
+
+func atlantisChangeSet(db *bbolt.DB, flags *atlantisFlags, pull models.PullStatus) (changeSet, error) {
+	res := changeSet{
 		ExecutableName: flags.ExecutableName,
-		PRRepo:         pull.Pull.BaseRepo.FullName,
-		PRNum:          pull.Pull.Num,
-		PRURL:          pull.Pull.URL,
+		VCSHost:        pull.Pull.BaseRepo.VCSHost.Hostname,
+		VCSType:        pull.Pull.BaseRepo.VCSHost.Type.String(),
+		Repo:           pull.Pull.BaseRepo.FullName,
+		Num:            pull.Pull.Num,
+		URL:            pull.Pull.URL,
+		CloneURL:       pull.Pull.BaseRepo.SanitizedCloneURL,
+		Author:         pull.Pull.Author,
+		HeadCommit:     pull.Pull.HeadCommit,
+		HeadBranch:     pull.Pull.HeadBranch,
+		BaseBranch:     pull.Pull.BaseBranch,
 	}
 
 	locks, err := getLocks(db)
 	if err != nil {
-		return uiData{}, err
+		return changeSet{}, err
 	}
-	log.Println("got locks")
+	slog.Debug("got locks")
 
 	logURLs, err := getLogURLs(flags.AtlantisURL)
 	if err != nil {
-		return uiData{}, err
+		return changeSet{}, err
 	}
 
 	for _, prj := range pull.Projects {
-		uiPrj, err := convertStack(pull, prj, locks, logURLs, flags.AtlantisURL)
-		if err != nil {
-			return uiData{}, err
+		stack := changeSetStack{
+			Name:      prj.ProjectName,
+			Path:      prj.RepoRelDir,
+			Workspace: prj.Workspace,
+			LogURL:    logURLs[formatProjectLogKey(pull.Pull, prj)],
+			PlanDir:   fmt.Sprintf("%s/%s/%d/%s/", *plansDir, *vcsRepo, *vcsPull, prj.RepoRelDir),
+		}
+
+		// this includes plan errors and locked projects
+		if prj.Status == models.ErroredPlanStatus {
+			stack.PlanError = true
+
+			lockID := fmt.Sprintf("%s/%s/%s", pull.Pull.BaseRepo.FullName, prj.RepoRelDir, prj.Workspace)
+			if lock := locks[lockID]; lock != nil {
+				// this check should be redundant, but just in case
+				if lock.Pull.BaseRepo.FullName != pull.Pull.BaseRepo.FullName || lock.Pull.Num != pull.Pull.Num {
+					stack.Lock = &changeSetLock{
+						URL:      flags.AtlantisURL + "/lock?id=" + url.QueryEscape(lockID),
+						PRURL:    lock.Pull.URL,
+						PRAuthor: lock.Pull.Author,
+					}
+				}
+			}
+		} else if prj.Status != models.PlannedPlanStatus && prj.Status != models.PlannedNoChangesPlanStatus {
+			slog.Warn("got unexpected project status, grabbing latest plan anyway",
+				"project", prj.ProjectName, "path", prj.RepoRelDir, "workspace", prj.Workspace, "status", prj.Status.String())
 		}
-		res.Stacks = append(res.Stacks, uiPrj)
+
+		res.Stacks = append(res.Stacks, stack)
 	}
 	return res, nil
 }
 
-func convertStack(pull models.PullStatus, prj models.ProjectStatus, locks map[string]*models.ProjectLock, logURLs map[string]string, atlantisURL string) (uiStack, error) {
-	uiPrj := uiStack{
-		Name:   prj.ProjectName,
-		Path:   prj.RepoRelDir,
-		LogURL: logURLs[formatProjectLogKey(pull.Pull, prj)],
+// convertChangeSet converts plans of all stacks and fills PR-wide data.
+func convertChangeSet(cs changeSet) uiData {
+	res := uiData{
+		ExecutableName: cs.ExecutableName,
+		RunID:          runID,
+		VCSHost:        cs.VCSHost,
+		VCSType:        cs.VCSType,
+		PRRepo:         cs.Repo,
+		PRNum:          cs.Num,
+		PRURL:          cs.URL,
+		PRCloneURL:     cs.CloneURL,
+		PRAuthor:       cs.Author,
+		PRHeadCommit:   cs.HeadCommit,
+		PRHeadBranch:   cs.HeadBranch,
 	}
 
-	// this includes plan errors and locked projects
-	if prj.Status == models.ErroredPlanStatus {
-		uiPrj.PlanError = true
+	res.Stacks = convertStacks(len(cs.Stacks), func(i int) (uiStack, error) {
+		return convertStack(cs.Stacks[i])
+	})
+
+	ref := *baseRef
+	if ref == "" && cs.BaseBranch != "" {
+		ref = "origin/" + cs.BaseBranch
+	}
+	annotatePull(&res, ref)
 
-		lockID := fmt.Sprintf("%s/%s/%s", pull.Pull.BaseRepo.FullName, prj.RepoRelDir, prj.Workspace)
-		if lock := locks[lockID]; lock != nil {
-			// this check should be redundant, but just in case
-			if lock.Pull.BaseRepo.FullName != pull.Pull.BaseRepo.FullName || lock.Pull.Num != pull.Pull.Num {
-				uiPrj.LockURL = atlantisURL + "/lock?id=" + url.QueryEscape(lockID)
-				uiPrj.LockPRURL = lock.Pull.URL
-				uiPrj.LockPRAuthor = lock.Pull.Author
+	return res
+}
+
+// convertStacks runs convert for each of n stacks in parallel, as stacks are independent, but plans might be huge.
+func convertStacks(n int, convert func(i int) (uiStack, error)) []uiStack {
+	res := make([]uiStack, n)
+
+	idxs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(*workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxs {
+				uiPrj, err := convert(i)
+				if err != nil {
+					// don't fail the whole PR because of a single broken stack, show it in the UI instead
+					stackLogger(uiPrj).Error("failed to convert stack", "err", err)
+					uiPrj.ConversionError = err.Error()
+					recordParseFailure(err)
+				}
+				res[i] = uiPrj
 			}
+		}()
+	}
+	for i := range n {
+		idxs <- i
+	}
+	close(idxs)
+	wg.Wait()
+
+	return res
+}
+
+// annotatePull orders converted stacks and fills PR-wide data, baseRef is used to detect version changes if not empty.
+func annotatePull(res *uiData, baseRef string) {
+	var graph *stackGraph
+	if *repoDir != "" {
+		var err error
+		graph, err = loadTerragruntGraph(*repoDir)
+		if err != nil {
+			slog.Warn("failed to load Terragrunt dependency graph", "err", err)
+		} else {
+			graph.annotateStacks(res.Stacks)
+		}
+	}
+	sortStacks(res.Stacks, graph)
+
+	res.ResourceGroups = pullResourceGroups(res.Stacks)
+	res.Cost = pullCost(res.Stacks)
+
+	if *repoDir != "" {
+		if err := annotateOutputConsumers(*repoDir, res.Stacks, *consumersScanRepo); err != nil {
+			slog.Warn("failed to find consumers of changed outputs", "err", err)
+		}
+		if baseRef != "" {
+			annotateVersionChanges(*repoDir, baseRef, res.Stacks)
 		}
+	}
+}
 
+func convertStack(stack changeSetStack) (uiStack, error) {
+	uiPrj := uiStack{
+		Name:      stack.Name,
+		Path:      stack.Path,
+		Workspace: stack.Workspace,
+		LogURL:    stack.LogURL,
+	}
+
+	if stack.Lock != nil {
+		uiPrj.PlanError = true
+		uiPrj.LockURL = stack.Lock.URL
+		uiPrj.LockPRURL = stack.Lock.PRURL
+		uiPrj.LockPRAuthor = stack.Lock.PRAuthor
 		return uiPrj, nil
 	}
+	if stack.PlanError {
+		uiPrj.PlanError = true
+		return uiPrj, nil
+	}
+
+	planDir := strings.TrimSuffix(stack.PlanDir, "/") + "/"
+	if stack.PlanFile != "" {
+		showDir, err := os.MkdirTemp("", "atlantis-plan-ui-show-")
+		if err != nil {
+			return uiPrj, err
+		}
+		defer os.RemoveAll(showDir)
+
+		if err := showPlanFile(stack.PlanFile, showDir); err != nil {
+			return uiPrj, fmt.Errorf("failed to show plan: %w", err)
+		}
+		planDir = showDir + "/"
+	}
+
+	// uiPrj is returned on errors too, so that the stack is still listed in the UI
+	err := convertPlanDir(&uiPrj, planDir)
+	return uiPrj, err
+}
+
+// planParseError is a failure of one of plan parsers, told apart in metrics.
+type planParseError struct {
+	// parser is planParserJSON or planParserText
+	parser string
+	err    error
+}
+
+const (
+	planParserJSON = "json"
+	planParserText = "text"
+)
 
-	if prj.Status != models.PlannedPlanStatus && prj.Status != models.PlannedNoChangesPlanStatus {
-		log.Printf("got unexpected status for project %s: %s, grabbing latest plan anyway", prj.ProjectName, prj.Status)
+func (e *planParseError) Error() string {
+	name := "JSON"
+	if e.parser == planParserText {
+		name = "text"
 	}
+	return fmt.Sprintf("failed to parse %s plan: %v", name, e.err)
+}
+
+func (e *planParseError) Unwrap() error {
+	return e.err
+}
 
-	planDir := fmt.Sprintf("%s/%s/%d/%s/", *plansDir, *vcsRepo, *vcsPull, prj.RepoRelDir)
+// convertPlanDir fills the stack from plan.json and plan.txt in planDir, which must end with a slash.
+func convertPlanDir(uiPrj *uiStack, planDir string) error {
 	tfp, err := parseJSONPlan(planDir + "plan.json")
 	if err != nil {
-		return uiStack{}, err
+		return &planParseError{parser: planParserJSON, err: err}
 	}
 
 	txts, err := parseTextPlan(planDir + "plan.txt")
 	if err != nil {
-		return uiStack{}, err
+		return &planParseError{parser: planParserText, err: err}
+	}
+
+	if *costMode != "" {
+		// cost is an optional addition, plan is still useful without it
+		uiPrj.Cost, err = stackCost(planDir)
+		if err != nil {
+			stackLogger(*uiPrj).Warn("failed to get cost estimation", "err", err)
+		}
 	}
 
+	uiPrj.Engine = detectEngine(tfp, txts)
+	uiPrj.EngineVersion = tfp.TerraformVersion
+	uiPrj.Notices = txts.notices
 	uiPrj.uiProjectDiffs = convertStackPlan(tfp, txts)
 
-	return uiPrj, nil
+	return nil
 }
 
+// convertStackPlan converts a parsed plan to UI diffs.
 func convertStackPlan(tf *tfPlan, txt *textualValues) uiProjectDiffs {
 	res := uiProjectDiffs{}
 
@@ -285,16 +544,21 @@ func convertStackPlan(tf *tfPlan, txt *textualValues) uiProjectDiffs {
 			Address:  resCh.Address,
 			Actions:  ch.Actions,
 			Diff:     txt.diffs[resCh.Address],
+			DiffHash: diffHash(strings.Join(ch.Actions, ",") + "\n" + txt.diffs[resCh.Address]),
 			ImportID: importID,
 		})
+
+		res.ResourceGroups = addResourceGroups(res.ResourceGroups, uiResourceGroup{
+			Type:     resCh.Type,
+			Provider: resCh.ProviderName,
+			Module:   resCh.ModuleAddress,
+			Action:   resourceAction(ch),
+			Count:    1,
+		})
 	}
+	sortResourceGroups(res.ResourceGroups)
 
 	for _, resDr := range tf.ResourceDrift {
-		if !changedAddrs[resDr.Address] {
-			// replicate terraform behaviour: don't show drifts for non-modified objs
-			continue
-		}
-
 		diff := txt.drifts[resDr.Address]
 		if diff == "" {
 			diff = "No textual diff available for this drift. Most likely terraform did not include it in the plan."
@@ -303,6 +567,8 @@ func convertStackPlan(tf *tfPlan, txt *textualValues) uiProjectDiffs {
 		res.DriftDiffs = append(res.DriftDiffs, uiDiff{
 			Address: resDr.Address,
 			Diff:    diff,
+			// terraform doesn't show drifts for non-modified objs, but refresh-only changes are still worth seeing
+			Unchanged: !changedAddrs[resDr.Address],
 		})
 	}
 
@@ -404,36 +670,102 @@ func formatProjectLogKey(pull models.PullRequest, prj models.ProjectStatus) stri
 	return fmt.Sprintf("%s #%d %s %s", pull.BaseRepo.FullName, pull.Num, prj.RepoRelDir, prj.Workspace)
 }
 
+// snapshotID returns the namespaced name of the PR snapshot, relative to the output dir, without the extension.
+// Snapshots are namespaced by VCS host and repo, so PRs with the same number in different repos don't collide.
+func snapshotID(vcsHost, repo string, pull int) string {
+	return fmt.Sprintf("%s/%s/%d", vcsHost, repo, pull)
+}
+
+// snapshotHash returns the hash of the snapshot contents, which names its immutable copy.
+// The run ID is left out, so that replans with the same result keep the same hash and link.
+func snapshotHash(res uiData) (string, error) {
+	res.RunID = ""
+	jsonData, err := json.Marshal(res)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", md5.Sum(jsonData)), nil
+}
+
 func writeUIData(res uiData) (string, error) {
 	jsonData, err := json.Marshal(res)
 	if err != nil {
 		return "", err
 	}
+	hash, err := snapshotHash(res)
+	if err != nil {
+		return "", err
+	}
 
-	hasher := md5.New()
-	hasher.Write(jsonData)
-	hash := fmt.Sprintf("%x", hasher.Sum(nil))
+	snapshot := filepath.Join(*outputDir, snapshotID(res.VCSHost, res.PRRepo, res.PRNum))
+	if err := os.MkdirAll(filepath.Dir(snapshot), 0755); err != nil {
+		return "", err
+	}
 
-	if err := os.WriteFile(fmt.Sprintf("%s/%d.json", *outputDir, *vcsPull), jsonData, 0644); err != nil {
+	// the hashed snapshot goes first, so that the latest one always has a permanent link
+	if err := writeFileAtomic(fmt.Sprintf("%s_%s.json", snapshot, hash), jsonData); err != nil {
 		return "", err
 	}
-	if err := os.WriteFile(fmt.Sprintf("%s/%d_%s.json", *outputDir, *vcsPull, hash), jsonData, 0644); err != nil {
+	if err := writeFileAtomic(fmt.Sprintf("%s.json", snapshot), jsonData); err != nil {
 		return "", err
 	}
 	return hash, nil
 }
 
-func renderComment(data uiData, hash string) (string, error) {
+// writeFileAtomic writes data to a temp file in the same dir and renames it to fname,
+// so that the server and the viewers never read a partially written file.
+func writeFileAtomic(fname string, data []byte) error {
+	// the suffix keeps temp files from matching snapshot names, the dot hides them from directory listings
+	f, err := os.CreateTemp(filepath.Dir(fname), "."+filepath.Base(fname)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	// CreateTemp uses 0600, snapshots are read by the server, which might run as another user
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fname)
+}
+
+// snapshotURL returns the link to the viewer at baseURL for the given snapshot.
+func snapshotURL(baseURL string, data uiData, hash string) string {
+	var segments []string
+	for _, seg := range strings.Split(snapshotID(data.VCSHost, data.PRRepo, data.PRNum), "/") {
+		segments = append(segments, url.PathEscape(seg))
+	}
+	return fmt.Sprint(baseURL, "#", strings.Join(segments, "/"), "_", hash)
+}
+
+// renderComment renders the PR comment, reviewed is nil if acks are not enabled.
+func renderComment(data uiData, hash string, reviewed *reviewProgress) (string, error) {
 	t := template.Must(template.New("comment").Parse(`
 ## [↗️ Plans viewer]({{ .URL }})
 
 * Total stacks: **{{ .TotalStacks }}**
+{{ with .Reviewed -}}
+{{ if gt .Total 0 -}}
+* 👀 Reviewed resource diffs: **{{ .Reviewed }}/{{ .Total }}**
+{{ end -}}
+{{ end -}}
 {{ if gt .StacksErrored 0 -}}
 * ⚠️ With plan errors: **{{ .StacksErrored }}**
 {{ end -}}
 {{ if gt .StacksLocked 0 -}}
 * ⌛️ Locked: **{{ .StacksLocked }}**
 {{ end -}}
+{{ if gt .StacksConversionErrored 0 -}}
+* 💥 Failed to process plan: **{{ .StacksConversionErrored }}**
+{{ end -}}
 {{ if gt .StacksWithRsrcChanges 0 -}}
 * 📋 With resource changes: **{{ .StacksWithRsrcChanges }}** (
 {{- if gt .StacksWithCreates 0 }}🟢 **{{ .StacksWithCreates }}** w/creates; {{ end -}}
@@ -450,6 +782,9 @@ func renderComment(data uiData, hash string) (string, error) {
 {{ if gt .StacksWithDrifts 0 -}}
 * ↙️ With drifts: **{{ .StacksWithDrifts }}**
 {{ end -}}
+{{ if gt .StacksWithUnchangedDrifts 0 -}}
+* 👻 With drifts on unchanged resources: **{{ .StacksWithUnchangedDrifts }}**
+{{ end -}}
 {{ if gt .StacksWithMoves 0 -}}
 * 🔁 With moves: **{{ .StacksWithMoves }}**
 {{ end -}}
@@ -459,106 +794,207 @@ func renderComment(data uiData, hash string) (string, error) {
 {{ if gt .StacksWithForgets 0 -}}
 * 🪦 With forgets: **{{ .StacksWithForgets }}**
 {{ end -}}
+{{ with .Cost -}}
+* 💰 Monthly cost change: **{{ .FormatDiff }}** ({{ .PastMonthlyCost }} → {{ .MonthlyCost }} {{ .Currency }})
+{{ end -}}
+{{ if gt .StacksWithVersionChanges 0 -}}
+* 📦 With provider/module version changes: **{{ .StacksWithVersionChanges }}** ({{ .VersionChanges }})
+{{ end -}}
+{{ if .TopResourceGroups -}}
+* 🧮 Largest changes:
+{{ range .TopResourceGroups -}}
+{{ "  " }}* **{{ .Count }}** ` + "`{{ .Type }}`" + ` {{ .Action }}s{{ if .Module }} in ` + "`{{ .Module }}`" + `{{ end }}
+{{ end -}}
+{{ end -}}
 `))
 
 	var templateData = struct {
-		URL                     string
-		TotalStacks             int
-		StacksErrored           int
-		StacksLocked            int
-		StacksWithRsrcChanges   int
-		StacksWithCreates       int
-		StacksWithUpdates       int
-		StacksWithDeletes       int
-		StacksWithZeroDiff      int
-		StacksWithOutputChanges int
-		StacksWithDrifts        int
-		StacksWithMoves         int
-		StacksWithImports       int
-		StacksWithForgets       int
+		pullSummary
+		URL      string
+		Reviewed *reviewProgress
 	}{
-		URL:         fmt.Sprint(*uiURL, "#", *vcsPull, "_", hash),
+		pullSummary: getPullSummary(data),
+		URL:         snapshotURL(*uiURL, data, hash),
+		Reviewed:    reviewed,
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, templateData); err != nil {
+		return "", fmt.Errorf("failed to render comment: %w", err)
+	}
+	comment := buf.String()
+	return comment, nil
+}
+
+// pullSummary are PR-wide counters, shown in the comment and sent in notifications.
+type pullSummary struct {
+	TotalStacks               int               `json:"total_stacks"`
+	StacksErrored             int               `json:"stacks_errored"`
+	StacksLocked              int               `json:"stacks_locked"`
+	StacksConversionErrored   int               `json:"stacks_conversion_errored"`
+	StacksWithRsrcChanges     int               `json:"stacks_with_resource_changes"`
+	StacksWithCreates         int               `json:"stacks_with_creates"`
+	StacksWithUpdates         int               `json:"stacks_with_updates"`
+	StacksWithDeletes         int               `json:"stacks_with_deletes"`
+	StacksWithZeroDiff        int               `json:"stacks_with_zero_diff"`
+	StacksWithOutputChanges   int               `json:"stacks_with_output_changes"`
+	StacksWithDrifts          int               `json:"stacks_with_drifts"`
+	StacksWithUnchangedDrifts int               `json:"stacks_with_unchanged_drifts"`
+	StacksWithMoves           int               `json:"stacks_with_moves"`
+	StacksWithImports         int               `json:"stacks_with_imports"`
+	StacksWithForgets         int               `json:"stacks_with_forgets"`
+	StacksWithVersionChanges  int               `json:"stacks_with_version_changes"`
+	VersionChanges            string            `json:"version_changes,omitempty"`
+	TopResourceGroups         []uiResourceGroup `json:"top_resource_groups,omitempty"`
+	Cost                      *uiCost           `json:"cost,omitempty"`
+}
+
+func getPullSummary(data uiData) pullSummary {
+	res := pullSummary{
 		TotalStacks: len(data.Stacks),
+		Cost:        data.Cost,
+	}
+
+	// single changes are visible from the counters above anyway
+	for _, g := range data.ResourceGroups {
+		if g.Count > 1 && len(res.TopResourceGroups) < 5 {
+			res.TopResourceGroups = append(res.TopResourceGroups, g)
+		}
 	}
 
+	var versionChanges []string
+	for _, stack := range data.Stacks {
+		if len(stack.VersionChanges) > 0 {
+			res.StacksWithVersionChanges++
+		}
+		for _, ch := range stack.VersionChanges {
+			if s := ch.String(); !slices.Contains(versionChanges, s) {
+				versionChanges = append(versionChanges, s)
+			}
+		}
+	}
+	slices.Sort(versionChanges)
+	res.VersionChanges = strings.Join(versionChanges, "; ")
+
 	for _, stack := range data.Stacks {
 		if stack.LockURL != "" {
-			templateData.StacksLocked++
+			res.StacksLocked++
 			continue
 		}
 		if stack.PlanError {
-			templateData.StacksErrored++
+			res.StacksErrored++
+			continue
+		}
+		if stack.ConversionError != "" {
+			res.StacksConversionErrored++
 			continue
 		}
 
 		if len(stack.ResourceDiffs) > 0 {
-			templateData.StacksWithRsrcChanges++
+			res.StacksWithRsrcChanges++
 			if slices.ContainsFunc(stack.ResourceDiffs, func(d uiDiff) bool {
 				return slices.Contains(d.Actions, "create")
 			}) {
-				templateData.StacksWithCreates++
+				res.StacksWithCreates++
 			}
 
 			if slices.ContainsFunc(stack.ResourceDiffs, func(d uiDiff) bool {
 				return slices.Contains(d.Actions, "update")
 			}) {
-				templateData.StacksWithUpdates++
+				res.StacksWithUpdates++
 			}
 
 			if slices.ContainsFunc(stack.ResourceDiffs, func(d uiDiff) bool {
 				return slices.Contains(d.Actions, "delete")
 			}) {
-				templateData.StacksWithDeletes++
+				res.StacksWithDeletes++
 			}
 			if slices.ContainsFunc(stack.ResourceDiffs, func(d uiDiff) bool {
 				return slices.Contains(d.Actions, "forget")
 			}) {
-				templateData.StacksWithForgets++
+				res.StacksWithForgets++
 			}
 		} else {
-			templateData.StacksWithZeroDiff++
+			res.StacksWithZeroDiff++
 		}
 		if len(stack.OutputDiffs) > 0 {
-			templateData.StacksWithOutputChanges++
+			res.StacksWithOutputChanges++
+		}
+		if slices.ContainsFunc(stack.DriftDiffs, func(d uiDiff) bool { return !d.Unchanged }) {
+			res.StacksWithDrifts++
 		}
-		if len(stack.DriftDiffs) > 0 {
-			templateData.StacksWithDrifts++
+		if slices.ContainsFunc(stack.DriftDiffs, func(d uiDiff) bool { return d.Unchanged }) {
+			res.StacksWithUnchangedDrifts++
 		}
 		if len(stack.Moves) > 0 {
-			templateData.StacksWithMoves++
+			res.StacksWithMoves++
 		}
 		if slices.ContainsFunc(stack.ResourceDiffs, func(d uiDiff) bool {
 			return d.ImportID != ""
 		}) {
-			templateData.StacksWithImports++
+			res.StacksWithImports++
 		}
 	}
 
-	var buf bytes.Buffer
-	if err := t.Execute(&buf, templateData); err != nil {
-		return "", fmt.Errorf("failed to render comment: %w", err)
-	}
-	comment := buf.String()
-	return comment, nil
+	return res
 }
 
 type uiData struct {
 	ExecutableName string `json:"executable_name"`
-
-	PRRepo string `json:"pr_repo"`
-	PRNum  int    `json:"pr_num"`
-	PRURL  string `json:"pr_url"`
+	// RunID is the ID of the last run which wrote the snapshot, logged in every line of the run.
+	// It's not a part of the snapshot hash.
+	RunID string `json:"run_id,omitempty"`
+
+	VCSHost string `json:"vcs_host"`
+	VCSType string `json:"vcs_type"`
+	PRRepo  string `json:"pr_repo"`
+	PRNum   int    `json:"pr_num"`
+	PRURL   string `json:"pr_url"`
+	// PRCloneURL is the clone URL without credentials, Bitbucket Server needs it to post comments
+	PRCloneURL   string `json:"pr_clone_url,omitempty"`
+	PRAuthor     string `json:"pr_author"`
+	PRHeadCommit string `json:"pr_head_commit"`
+	PRHeadBranch string `json:"pr_head_branch"`
 
 	Stacks []uiStack `json:"stacks"`
+
+	// ResourceGroups are resource changes of all stacks grouped by type, module and action
+	ResourceGroups []uiResourceGroup `json:"resource_groups,omitempty"`
+
+	// Cost is the total of stack costs, set only if -cost is specified
+	Cost *uiCost `json:"cost,omitempty"`
 }
 
 type uiStack struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Workspace string `json:"workspace,omitempty"`
 
 	PlanError bool   `json:"plan_error"`
 	LogURL    string `json:"log_url"`
 
+	// ConversionError is set when plan files of the stack could not be processed, diffs are empty in this case
+	ConversionError string `json:"conversion_error,omitempty"`
+
+	// Upstream and Downstream are repo-relative dirs of Terragrunt stacks this stack directly depends on,
+	// and all stacks depending on it, directly or through other stacks.
+	// Set only if -repo-dir is specified.
+	Upstream   []string `json:"upstream,omitempty"`
+	Downstream []string `json:"downstream,omitempty"`
+
+	// VersionChanges are changes of provider versions in the lock file and module versions, compared to the base branch.
+	// Set only if -repo-dir is specified.
+	VersionChanges []uiVersionChange `json:"version_changes,omitempty"`
+
+	// Cost is set only if -cost is specified and estimation succeeded
+	Cost *uiCost `json:"cost,omitempty"`
+
+	// Engine is either "terraform" or "opentofu", set only for successfully parsed plans
+	Engine        string `json:"engine,omitempty"`
+	EngineVersion string `json:"engine_version,omitempty"`
+	// Notices are warnings printed with the plan, e.g. about state encryption or resources to forget
+	Notices []string `json:"notices,omitempty"`
+
 	LockURL      string `json:"lock_url,omitempty"`
 	LockPRURL    string `json:"lock_pr_url,omitempty"`
 	LockPRAuthor string `json:"lock_pr_author,omitempty"`
@@ -571,6 +1007,8 @@ type uiProjectDiffs struct {
 	OutputDiffs   []uiDiff `json:"output_diffs,omitempty"`
 	DriftDiffs    []uiDiff `json:"drift_diffs,omitempty"`
 	Moves         []uiDiff `json:"moves,omitempty"`
+
+	ResourceGroups []uiResourceGroup `json:"resource_groups,omitempty"`
 }
 
 type uiDiff struct {
@@ -583,28 +1021,63 @@ type uiDiff struct {
 	// Diff is set resource, output, and drift diffs and is a textual diff
 	Diff string `json:"diff,omitempty"`
 
+	// DiffHash is set for resource diffs, it changes when the diff changes between replans, see ack
+	DiffHash string `json:"diff_hash,omitempty"`
+
 	// PreviousAddress is set for moves (and all other fields are empty), otherwise empty
 	PreviousAddress string `json:"previous_address,omitempty"`
 
 	// ImportID is set for imports, action might be "no-op" in this case
 	ImportID string `json:"import_id,omitempty"`
+
+	// Unchanged is set for drift diffs of resources not changed by the plan, Terraform doesn't show these
+	Unchanged bool `json:"unchanged,omitempty"`
+
+	// Consumers is set for output diffs, repo-relative dirs of stacks reading the output
+	Consumers []string `json:"consumers,omitempty"`
 }
 
 func main() {
 	flag.Parse()
 
+	if err := setupLogging(); err != nil {
+		fatal(err)
+	}
+
 	if *printVersion {
 		fmt.Println("atlantis-plan-ui", version)
 		return
 	}
 
+	if *migrateOutputDir {
+		if err := runMigrate(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *localDir != "" {
+		if err := runLocal(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *driftReport != "" {
+		if err := runDriftReport(*driftReport); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
 	if *serve != "" {
 		if err := runServe(*serve); err != nil {
-			panic(err)
+			fatal(err)
 		}
+		return
 	}
 
 	if err := run(); err != nil {
-		panic(err)
+		fatal(err)
 	}
 }
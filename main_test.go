@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestConvertStackPlanOpenTofu(t *testing.T) {
+	planJSON := filepath.Join(t.TempDir(), "plan.json")
+	err := os.WriteFile(planJSON, []byte(`{
+		"format_version": "1.2",
+		"terraform_version": "1.8.3",
+		"resource_changes": [
+			{"address": "aws_s3_bucket.imported[\"logs\"]", "mode": "managed", "type": "aws_s3_bucket",
+			 "provider_name": "registry.opentofu.org/hashicorp/aws", "change": {"actions": ["no-op"], "importing": {"id": "logs"}}},
+			{"address": "aws_s3_bucket.imported[\"data\"]", "mode": "managed", "type": "aws_s3_bucket",
+			 "provider_name": "registry.opentofu.org/hashicorp/aws", "change": {"actions": ["no-op"], "importing": {"unknown": true}}},
+			{"address": "aws_instance.legacy", "mode": "managed", "type": "aws_instance",
+			 "provider_name": "registry.opentofu.org/hashicorp/aws", "change": {"actions": ["forget"]}}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tfp, err := parseJSONPlan(planJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt, err := parseTextPlan("testdata/tftext/opentofu-1.8.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engine := detectEngine(tfp, txt); engine != engineOpenTofu {
+		t.Errorf("detectEngine() = %q, want %q", engine, engineOpenTofu)
+	}
+
+	type diff struct {
+		Address  string
+		Actions  []string
+		ImportID string
+		HasText  bool
+	}
+	var got []diff
+	for _, d := range convertStackPlan(tfp, txt).ResourceDiffs {
+		got = append(got, diff{Address: d.Address, Actions: d.Actions, ImportID: d.ImportID, HasText: d.Diff != ""})
+	}
+	want := []diff{
+		{Address: `aws_s3_bucket.imported["logs"]`, Actions: []string{"no-op"}, ImportID: "logs", HasText: true},
+		{Address: `aws_s3_bucket.imported["data"]`, Actions: []string{"no-op"}, ImportID: "(unknown)", HasText: true},
+		{Address: "aws_instance.legacy", Actions: []string{"forget"}, HasText: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resource diffs = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteUIDataRunID(t *testing.T) {
+	old := *outputDir
+	*outputDir = t.TempDir()
+	defer func() { *outputDir = old }()
+
+	stack := uiStack{Path: "prod/vpc"}
+	stack.ResourceDiffs = []uiDiff{{Address: "aws_vpc.main", Actions: []string{"update"}}}
+	data := uiData{VCSHost: "github.com", PRRepo: "org/infra", PRNum: 7, RunID: "run1", Stacks: []uiStack{stack}}
+	first, err := writeUIData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a replan with the same result
+	data.RunID = "run2"
+	second, err := writeUIData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Errorf("hash changed from %s to %s with the run ID only", first, second)
+	}
+	read, hash, err := readSnapshot("github.com/org/infra/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != first || read.RunID != "run2" {
+		t.Errorf("readSnapshot() = run %q, hash %s, want run2, %s", read.RunID, hash, first)
+	}
+
+	data.Stacks[0].ResourceDiffs[0].Actions = []string{"delete"}
+	if third, err := writeUIData(data); err != nil {
+		t.Fatal(err)
+	} else if third == first {
+		t.Error("hash didn't change with the plan")
+	}
+}
+
+func TestConvertStacks(t *testing.T) {
+	old := *workers
+	*workers = 8
+	defer func() { *workers = old }()
+
+	const n = 100
+	res := convertStacks(n, func(i int) (uiStack, error) {
+		// later stacks finish first, so that the order of results doesn't follow the order of completion
+		time.Sleep(time.Duration(n-i) * 50 * time.Microsecond)
+		s := uiStack{Path: fmt.Sprintf("stack-%d", i)}
+		if i%7 == 3 {
+			return s, fmt.Errorf("broken plan %d", i)
+		}
+		return s, nil
+	})
+
+	if len(res) != n {
+		t.Fatalf("got %d stacks, want %d", len(res), n)
+	}
+	for i, s := range res {
+		if want := fmt.Sprintf("stack-%d", i); s.Path != want {
+			t.Errorf("stack %d = %s, want %s", i, s.Path, want)
+		}
+		wantErr := ""
+		if i%7 == 3 {
+			wantErr = fmt.Sprintf("broken plan %d", i)
+		}
+		if s.ConversionError != wantErr {
+			t.Errorf("conversion error of stack %d = %q, want %q", i, s.ConversionError, wantErr)
+		}
+	}
+}
+
+func BenchmarkConvertStacks(b *testing.B) {
+	// a monorepo PR touching many mid-sized stacks
+	const numStacks = 32
+	root := b.TempDir()
+	stacks := make([]changeSetStack, numStacks)
+	for i := range stacks {
+		dir := filepath.Join(root, fmt.Sprintf("stack-%d", i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		writeBigPlan(b, dir, 4<<20)
+		stacks[i] = changeSetStack{Name: dir, Path: dir, PlanDir: dir}
+	}
+
+	old := *workers
+	defer func() { *workers = old }()
+
+	counts := []int{1, 4, runtime.NumCPU()}
+	slices.Sort(counts)
+	for _, n := range slices.Compact(counts) {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			*workers = n
+			for range b.N {
+				res := convertStacks(len(stacks), func(i int) (uiStack, error) {
+					return convertStack(stacks[i])
+				})
+				for _, s := range res {
+					if s.ConversionError != "" {
+						b.Fatal(s.ConversionError)
+					}
+				}
+			}
+		})
+	}
+}
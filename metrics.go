@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var (
+	metricsPushgateway = flag.String("metrics-pushgateway", "", "Push metrics of the hook run to the Prometheus Pushgateway at the URL")
+	metricsTextfile    = flag.String("metrics-textfile", "", "Write metrics of the hook run to the file, e.g. for the node_exporter textfile collector")
+	metricsJob         = flag.String("metrics-job", "atlantis_plan_ui", "Job name of metrics pushed to the Pushgateway")
+)
+
+// Server metrics, exposed on /metrics with Go runtime metrics of the default registry.
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "atlantis_plan_ui_http_requests_total",
+		Help: "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "atlantis_plan_ui_http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, except long-lived /events streams.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	snapshotsServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "atlantis_plan_ui_snapshots_served_total",
+		Help: "Number of requests of snapshot JSONs by status code.",
+	}, []string{"code"})
+)
+
+// runRegistry has metrics of a single hook run, pushed or written when it's done.
+// It's separate from the default registry, as Go runtime metrics of a short-lived process are of no use.
+var runRegistry = prometheus.NewRegistry()
+
+var (
+	runTimestamp = promauto.With(runRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "atlantis_plan_ui_run_timestamp_seconds",
+		Help: "Time the hook run finished at.",
+	})
+
+	runDuration = promauto.With(runRegistry).NewGauge(prometheus.GaugeOpts{
+		Name: "atlantis_plan_ui_run_duration_seconds",
+		Help: "Duration of the hook run.",
+	})
+
+	runStacks = promauto.With(runRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "atlantis_plan_ui_run_stacks",
+		Help: "Number of stacks in the PR by status: converted, conversion_error, plan_error or locked.",
+	}, []string{"status"})
+
+	runParseFailures = promauto.With(runRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "atlantis_plan_ui_run_parse_failures_total",
+		Help: "Number of stacks whose plan files failed to parse, by parser: json or text.",
+	}, []string{"parser"})
+
+	runDestructive = promauto.With(runRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "atlantis_plan_ui_run_destructive_resources",
+		Help: "Number of resources to be deleted or replaced in the PR, by action.",
+	}, []string{"action"})
+)
+
+func init() {
+	// zeros are exported too, so that alerts on parse failures work before the first one
+	for _, parser := range []string{planParserJSON, planParserText} {
+		runParseFailures.WithLabelValues(parser)
+	}
+}
+
+// instrumentHandler counts requests of the route and measures their latency.
+func instrumentHandler(route string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+	h = promhttp.InstrumentHandlerCounter(httpRequests.MustCurryWith(labels), h)
+	if route == "/events" {
+		// latency of server-sent events is the time viewers keep the page open
+		return h
+	}
+	return promhttp.InstrumentHandlerDuration(httpDuration.MustCurryWith(labels), h)
+}
+
+// countSnapshots counts requests of snapshot JSONs among other files in the output dir.
+func countSnapshots(h http.Handler) http.Handler {
+	counted := promhttp.InstrumentHandlerCounter(snapshotsServed, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			counted.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// recordParseFailure counts the stack conversion error if it's caused by one of plan parsers.
+func recordParseFailure(err error) {
+	var parseErr *planParseError
+	if errors.As(err, &parseErr) {
+		runParseFailures.WithLabelValues(parseErr.parser).Inc()
+	}
+}
+
+// writeRunMetrics sets metrics of the converted PR, and pushes them or writes them to the textfile, if configured.
+// Failures are only logged, as metrics are not essential for the hook.
+func writeRunMetrics(data uiData, start time.Time) {
+	if *metricsPushgateway == "" && *metricsTextfile == "" {
+		return
+	}
+
+	summary := getPullSummary(data)
+	runStacks.WithLabelValues("converted").Set(float64(summary.TotalStacks - summary.StacksLocked - summary.StacksErrored - summary.StacksConversionErrored))
+	runStacks.WithLabelValues("conversion_error").Set(float64(summary.StacksConversionErrored))
+	runStacks.WithLabelValues("plan_error").Set(float64(summary.StacksErrored))
+	runStacks.WithLabelValues("locked").Set(float64(summary.StacksLocked))
+
+	deletes, replaces := 0, 0
+	for _, stack := range data.Stacks {
+		for _, d := range stack.ResourceDiffs {
+			switch {
+			case !slices.Contains(d.Actions, "delete"):
+			case len(d.Actions) > 1:
+				replaces++
+			default:
+				deletes++
+			}
+		}
+	}
+	runDestructive.WithLabelValues("delete").Set(float64(deletes))
+	runDestructive.WithLabelValues("replace").Set(float64(replaces))
+
+	runDuration.Set(time.Since(start).Seconds())
+	runTimestamp.SetToCurrentTime()
+
+	if *metricsTextfile != "" {
+		if err := prometheus.WriteToTextfile(*metricsTextfile, runRegistry); err != nil {
+			slog.Warn("failed to write metrics to textfile", "err", err)
+		}
+	}
+
+	if *metricsPushgateway != "" {
+		// grouped by repo, so that runs in different repos don't overwrite each other
+		err := push.New(*metricsPushgateway, *metricsJob).
+			Gatherer(runRegistry).
+			Grouping("repo", data.VCSHost+"/"+data.PRRepo).
+			Push()
+		if err != nil {
+			slog.Warn("failed to push metrics", "err", err)
+		}
+	}
+}
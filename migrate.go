@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var migrateOutputDir = flag.Bool("migrate-output-dir", false, "Move flat <pull>.json files in -output-dir to namespaced <vcs-host>/<repo>/<pull>.json and exit")
+
+// flatSnapshotRe matches snapshot names written before namespacing: `12.json` and `12_<hash>.json`.
+var flatSnapshotRe = regexp.MustCompile(`^(\d+)(_[0-9a-f]+)?\.json$`)
+
+// runMigrate moves snapshots from the flat layout to the namespaced one.
+// VCS host and repo are not part of the old file name, so they are taken from the snapshot contents.
+func runMigrate() error {
+	if *outputDir == "" {
+		flag.Usage()
+		return fmt.Errorf("no -output-dir specified")
+	}
+
+	entries, err := os.ReadDir(*outputDir)
+	if err != nil {
+		return err
+	}
+
+	moved := 0
+	for _, e := range entries {
+		m := flatSnapshotRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+
+		src := filepath.Join(*outputDir, e.Name())
+		dst, err := migratedSnapshotPath(src, m[2])
+		if err != nil {
+			slog.Warn("skipping snapshot", "file", src, "err", err)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+		slog.Info("moved snapshot", "from", src, "to", dst)
+		moved++
+	}
+
+	slog.Info("migrated snapshots", "count", moved)
+	return nil
+}
+
+// migratedSnapshotPath returns the namespaced path for the flat snapshot file, hashSuffix is either empty or `_<hash>`.
+func migratedSnapshotPath(fname, hashSuffix string) (string, error) {
+	jsonData, err := os.ReadFile(fname)
+	if err != nil {
+		return "", err
+	}
+
+	var data uiData
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return "", err
+	}
+
+	if data.VCSHost == "" {
+		// old snapshots don't have the host, but PR URL always points to it
+		prURL, err := url.Parse(data.PRURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse PR URL: %w", err)
+		}
+		data.VCSHost = prURL.Hostname()
+	}
+
+	if data.VCSHost == "" || data.PRRepo == "" || data.PRNum == 0 {
+		return "", fmt.Errorf("snapshot doesn't have VCS host, repo or PR number")
+	}
+
+	return filepath.Join(*outputDir, snapshotID(data.VCSHost, data.PRRepo, data.PRNum)+hashSuffix+".json"), nil
+}
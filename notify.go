@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var notifyConfig = flag.String("notify-config", "", "Path to the YAML config of notification sinks (Slack, Teams, webhooks), notified after the UI data is written")
+
+// notifyTopDestructive limits the number of deletes and replacements listed in notifications.
+const notifyTopDestructive = 10
+
+type notifyConfigFile struct {
+	Sinks []notifySink `yaml:"sinks"`
+}
+
+// notifySink is a notification destination with filters, all filters must match for the sink to be notified.
+type notifySink struct {
+	// Name is used in logs only, defaults to type and index
+	Name string `yaml:"name"`
+	// Type is one of slack, teams or webhook
+	Type string `yaml:"type"`
+	URL  string `yaml:"url"`
+	// Secret signs webhook bodies with HMAC-SHA256, the signature is sent in X-Plan-UI-Signature header
+	Secret string `yaml:"secret"`
+
+	// Repos are globs of repo names, e.g. org/*
+	Repos []string `yaml:"repos"`
+	// Stacks are globs of stack paths, only deletes and replacements in matching stacks are considered
+	Stacks []string `yaml:"stacks"`
+	// MinDestructive is the minimum number of deletes and replacements, e.g. 1 for "only when deletes > 0"
+	MinDestructive int `yaml:"min_destructive"`
+}
+
+// notification is sent to sinks, it's also the body of generic webhooks.
+type notification struct {
+	Repo      string      `json:"repo"`
+	PRNum     int         `json:"pr_num"`
+	PRURL     string      `json:"pr_url"`
+	ViewerURL string      `json:"viewer_url"`
+	Summary   pullSummary `json:"summary"`
+
+	// DestructiveTotal is the number of deletes and replacements, only first of them are listed in Destructive
+	DestructiveTotal int                   `json:"destructive_total"`
+	Destructive      []destructiveResource `json:"destructive"`
+}
+
+type destructiveResource struct {
+	Stack   string   `json:"stack"`
+	Address string   `json:"address"`
+	Actions []string `json:"actions"`
+}
+
+func loadNotifyConfig(fname string) (notifyConfigFile, error) {
+	var res notifyConfigFile
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return res, err
+	}
+	if err := yaml.Unmarshal(data, &res); err != nil {
+		return res, err
+	}
+	for i, s := range res.Sinks {
+		if !slices.Contains([]string{"slack", "teams", "webhook"}, s.Type) {
+			return res, fmt.Errorf("sink %d: unknown type %q", i, s.Type)
+		}
+		if s.URL == "" {
+			return res, fmt.Errorf("sink %d: no url", i)
+		}
+		if s.Name == "" {
+			res.Sinks[i].Name = fmt.Sprintf("%s-%d", s.Type, i)
+		}
+	}
+	return res, nil
+}
+
+// notify sends the summary of the snapshot to all sinks matching it. Failed sinks don't stop the others.
+func notify(cfg notifyConfigFile, data uiData, viewerURL string) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, sink := range cfg.Sinks {
+		n, ok := sink.filter(data)
+		if !ok {
+			continue
+		}
+		n.ViewerURL = viewerURL
+
+		if err := sink.send(client, n); err != nil {
+			slog.Warn("failed to notify sink", "sink", sink.Name, "err", err)
+			continue
+		}
+		slog.Info("notified sink", "sink", sink.Name)
+	}
+}
+
+func matchAny(globs []string, val string) bool {
+	return slices.ContainsFunc(globs, func(glob string) bool {
+		ok, _ := path.Match(glob, val)
+		return ok
+	})
+}
+
+// filter returns the notification for the sink, or false if the sink is not interested in the snapshot.
+func (s notifySink) filter(data uiData) (notification, bool) {
+	if len(s.Repos) > 0 && !matchAny(s.Repos, data.PRRepo) {
+		return notification{}, false
+	}
+
+	res := notification{
+		Repo:    data.PRRepo,
+		PRNum:   data.PRNum,
+		PRURL:   data.PRURL,
+		Summary: getPullSummary(data),
+	}
+	for _, stack := range data.Stacks {
+		if len(s.Stacks) > 0 && !matchAny(s.Stacks, stack.Path) {
+			continue
+		}
+		for _, d := range stack.ResourceDiffs {
+			if !isDestructive(d.Actions) {
+				continue
+			}
+			res.DestructiveTotal++
+			if len(res.Destructive) < notifyTopDestructive {
+				res.Destructive = append(res.Destructive, destructiveResource{
+					Stack:   stack.Path,
+					Address: d.Address,
+					Actions: d.Actions,
+				})
+			}
+		}
+	}
+
+	if res.DestructiveTotal < s.MinDestructive {
+		return notification{}, false
+	}
+	return res, true
+}
+
+func (s notifySink) send(client *http.Client, n notification) error {
+	var body any
+	switch s.Type {
+	case "slack":
+		body = map[string]string{
+			"text": notificationText(n, func(text, url string) string { return fmt.Sprintf("<%s|%s>", url, text) }),
+		}
+	case "teams":
+		// adaptive card, as legacy message cards are not supported by Workflows webhooks
+		body = map[string]any{
+			"type": "message",
+			"attachments": []any{map[string]any{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body": []any{map[string]any{
+						"type": "TextBlock",
+						"text": notificationText(n, func(text, url string) string { return fmt.Sprintf("[%s](%s)", text, url) }),
+						"wrap": true,
+					}},
+				},
+			}},
+		}
+	default:
+		body = n
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Type == "webhook" && s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(data)
+		req.Header.Set("X-Plan-UI-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// notificationText renders a short markdown-like message, link formats differ between chats.
+func notificationText(n notification, link func(text, url string) string) string {
+	var b strings.Builder
+	title := fmt.Sprintf("%s#%d", n.Repo, n.PRNum)
+	if n.PRURL != "" {
+		title = link(title, n.PRURL)
+	}
+	fmt.Fprintf(&b, "%s: %d stacks with resource changes", title, n.Summary.StacksWithRsrcChanges)
+	if n.Summary.StacksWithDeletes > 0 {
+		fmt.Fprintf(&b, ", %d with deletes", n.Summary.StacksWithDeletes)
+	}
+	if n.Summary.StacksErrored > 0 {
+		fmt.Fprintf(&b, ", %d errored", n.Summary.StacksErrored)
+	}
+	if n.Summary.Cost != nil {
+		fmt.Fprintf(&b, ", monthly cost %s", n.Summary.Cost.FormatDiff())
+	}
+	b.WriteString("\n")
+
+	if n.DestructiveTotal > 0 {
+		fmt.Fprintf(&b, "\n%d deletes and replacements:\n", n.DestructiveTotal)
+		for _, d := range n.Destructive {
+			fmt.Fprintf(&b, "- `%s` %s (%s)\n", d.Stack, d.Address, strings.Join(d.Actions, ", "))
+		}
+		if more := n.DestructiveTotal - len(n.Destructive); more > 0 {
+			fmt.Fprintf(&b, "- and %d more\n", more)
+		}
+	}
+
+	if n.ViewerURL != "" {
+		fmt.Fprintf(&b, "\n%s\n", link("Open plans viewer", n.ViewerURL))
+	}
+	return b.String()
+}
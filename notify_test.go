@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNotify(t *testing.T) {
+	type received struct {
+		body      []byte
+		signature string
+	}
+	got := make(map[string]received)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: content type %q, want application/json", r.URL.Path, ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		got[r.URL.Path] = received{body: body, signature: r.Header.Get("X-Plan-UI-Signature")}
+		if r.URL.Path == "/broken" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := notifyConfigFile{Sinks: []notifySink{
+		// a failing sink must not stop the following ones
+		{Name: "broken", Type: "webhook", URL: srv.URL + "/broken"},
+		{Name: "slack", Type: "slack", URL: srv.URL + "/slack"},
+		{Name: "teams", Type: "teams", URL: srv.URL + "/teams"},
+		{Name: "webhook", Type: "webhook", URL: srv.URL + "/webhook", Secret: "s3cret", Stacks: []string{"prod/*"}},
+		{Name: "other-repo", Type: "webhook", URL: srv.URL + "/other-repo", Repos: []string{"org/other"}},
+		{Name: "many-deletes", Type: "webhook", URL: srv.URL + "/many-deletes", MinDestructive: 3},
+	}}
+
+	data := uiData{PRRepo: "org/infra", PRNum: 7, PRURL: "https://github.com/org/infra/pull/7"}
+	data.Stacks = []uiStack{{Path: "prod/db"}, {Path: "staging/db"}}
+	data.Stacks[0].ResourceDiffs = []uiDiff{
+		{Address: "aws_db_instance.main", Actions: []string{"delete", "create"}},
+		{Address: "aws_security_group.db", Actions: []string{"update"}},
+	}
+	data.Stacks[1].ResourceDiffs = []uiDiff{
+		{Address: "aws_db_instance.main", Actions: []string{"delete"}},
+	}
+
+	notify(cfg, data, "https://plans.example.com/pr/7")
+
+	for _, path := range []string{"/broken", "/slack", "/teams", "/webhook"} {
+		if _, ok := got[path]; !ok {
+			t.Errorf("%s was not notified", path)
+		}
+	}
+	for _, path := range []string{"/other-repo", "/many-deletes"} {
+		if _, ok := got[path]; ok {
+			t.Errorf("%s was notified, but filters don't match", path)
+		}
+	}
+
+	t.Run("slack", func(t *testing.T) {
+		var body map[string]string
+		if err := json.Unmarshal(got["/slack"].body, &body); err != nil {
+			t.Fatal(err)
+		}
+		want := "<https://github.com/org/infra/pull/7|org/infra#7>: 2 stacks with resource changes, 2 with deletes\n" +
+			"\n2 deletes and replacements:\n" +
+			"- `prod/db` aws_db_instance.main (delete, create)\n" +
+			"- `staging/db` aws_db_instance.main (delete)\n" +
+			"\n<https://plans.example.com/pr/7|Open plans viewer>\n"
+		if body["text"] != want {
+			t.Errorf("text = %q, want %q", body["text"], want)
+		}
+	})
+
+	t.Run("teams", func(t *testing.T) {
+		var body struct {
+			Type        string `json:"type"`
+			Attachments []struct {
+				ContentType string `json:"contentType"`
+				Content     struct {
+					Type string `json:"type"`
+					Body []struct {
+						Type string `json:"type"`
+						Text string `json:"text"`
+					} `json:"body"`
+				} `json:"content"`
+			} `json:"attachments"`
+		}
+		if err := json.Unmarshal(got["/teams"].body, &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Type != "message" || len(body.Attachments) != 1 ||
+			body.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" ||
+			body.Attachments[0].Content.Type != "AdaptiveCard" || len(body.Attachments[0].Content.Body) != 1 {
+			t.Fatalf("unexpected card: %s", got["/teams"].body)
+		}
+		want := "[org/infra#7](https://github.com/org/infra/pull/7): 2 stacks with resource changes, 2 with deletes\n" +
+			"\n2 deletes and replacements:\n" +
+			"- `prod/db` aws_db_instance.main (delete, create)\n" +
+			"- `staging/db` aws_db_instance.main (delete)\n" +
+			"\n[Open plans viewer](https://plans.example.com/pr/7)\n"
+		if text := body.Attachments[0].Content.Body[0].Text; text != want {
+			t.Errorf("text = %q, want %q", text, want)
+		}
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		r := got["/webhook"]
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(r.body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.signature != want {
+			t.Errorf("signature = %q, want %q", r.signature, want)
+		}
+		if s := got["/broken"].signature; s != "" {
+			t.Errorf("webhook without secret is signed: %q", s)
+		}
+
+		var n notification
+		if err := json.Unmarshal(r.body, &n); err != nil {
+			t.Fatal(err)
+		}
+		want := []destructiveResource{{Stack: "prod/db", Address: "aws_db_instance.main", Actions: []string{"delete", "create"}}}
+		if n.Repo != "org/infra" || n.PRNum != 7 || n.ViewerURL != "https://plans.example.com/pr/7" ||
+			n.DestructiveTotal != 1 || !reflect.DeepEqual(n.Destructive, want) {
+			t.Errorf("unexpected notification: %s", r.body)
+		}
+	})
+}
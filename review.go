@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/runatlantis/atlantis/server/events/models"
+)
+
+var reviewComments = flag.Bool("review-comments", false, "Allow posting comments on resource diffs from the UI to the PR, requires -atlantis-config")
+
+// reviewCommentContext is the number of diff lines quoted around the commented line.
+const reviewCommentContext = 3
+
+// reviewCommentMaxLines limits the quoted diff when the comment is not on a specific line.
+const reviewCommentMaxLines = 20
+
+// reviewComment is a comment on a resource diff, posted from the UI.
+type reviewComment struct {
+	Stack   string `json:"stack"`
+	Address string `json:"address"`
+	// Line is the 0-based line of the diff the comment refers to, -1 for the whole diff
+	Line int    `json:"line"`
+	Body string `json:"body"`
+}
+
+// reviewCommenter posts comments from the UI to the PR as the Atlantis VCS user.
+type reviewCommenter struct {
+	poster *commentPoster
+	auth   *authenticator
+}
+
+// ServeHTTP reports whether comments are available (GET) and posts a comment (POST).
+func (c *reviewCommenter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(map[string]string{"user": c.auth.user(r)})
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := checkSameOrigin(r); err != nil {
+		http.Error(rw, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	user := c.auth.user(r)
+	if user == "" {
+		http.Error(rw, "not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	snapshot := strings.Trim(r.URL.Query().Get("snapshot"), "/")
+	data, hash, err := readSnapshot(snapshot)
+	if err != nil {
+		http.Error(rw, "snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	var comment reviewComment
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 64<<10)).Decode(&comment); err != nil || strings.TrimSpace(comment.Body) == "" {
+		http.Error(rw, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	diff, ok := findResourceDiff(data, comment.Stack, comment.Address)
+	if !ok {
+		http.Error(rw, "diff not found in the latest plan, reload the page", http.StatusConflict)
+		return
+	}
+
+	repo, err := snapshotRepo(data)
+	if err != nil {
+		slog.Error("failed to get repo of snapshot", "snapshot", snapshot, "err", err)
+		http.Error(rw, "unsupported VCS", http.StatusInternalServerError)
+		return
+	}
+
+	// links are built from the configured URL only, the Host header is up to the client
+	link := snapshotURL(*uiURL, data, hash) + "~" + diffElementID(comment.Stack, comment.Address)
+	body := formatReviewComment(repo.VCSHost.Type, user, comment, diff, link)
+	if err := c.poster.postReviewComment(repo, data.PRNum, body); err != nil {
+		slog.Error("failed to post review comment", "snapshot", snapshot, "err", err)
+		http.Error(rw, "failed to post comment", http.StatusBadGateway)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func findResourceDiff(data uiData, stack, address string) (uiDiff, bool) {
+	for _, s := range data.Stacks {
+		if s.Path != stack {
+			continue
+		}
+		for _, d := range s.ResourceDiffs {
+			if d.Address == address {
+				return d, true
+			}
+		}
+	}
+	return uiDiff{}, false
+}
+
+// snapshotRepo restores the Atlantis repo model from the snapshot, with the fields VCS clients use for comments.
+func snapshotRepo(data uiData) (models.Repo, error) {
+	vcsType, err := models.NewVCSHostType(data.VCSType)
+	if err != nil {
+		return models.Repo{}, err
+	}
+
+	owner, name := "", data.PRRepo
+	if i := strings.LastIndex(data.PRRepo, "/"); i >= 0 {
+		owner, name = data.PRRepo[:i], data.PRRepo[i+1:]
+	}
+	return models.Repo{
+		FullName:          data.PRRepo,
+		Owner:             owner,
+		Name:              name,
+		SanitizedCloneURL: data.PRCloneURL,
+		VCSHost: models.VCSHost{
+			Hostname: data.VCSHost,
+			Type:     vcsType,
+		},
+	}, nil
+}
+
+var elementIDRe = regexp.MustCompile(`[^a-zA-Z0-9-_]`)
+
+// diffElementID returns the id of the resource diff element in the UI, same as Diff.addressSanitized in models.js.
+func diffElementID(stack, address string) string {
+	return elementIDRe.ReplaceAllString(stack, "-") + "__resource_" + elementIDRe.ReplaceAllString(address, "-")
+}
+
+// diffMarkerRe matches the change marker of a textual plan line, with its indent.
+var diffMarkerRe = regexp.MustCompile(`^(\s*)([-+~])`)
+
+// diffExcerpt returns lines of the diff around the line, or the beginning of the diff if line is out of range.
+// Change markers are moved to the line start, so that VCS highlights them as a diff, like Atlantis does.
+func diffExcerpt(diff string, line int) string {
+	lines := strings.Split(diff, "\n")
+
+	from, to := 0, min(len(lines), reviewCommentMaxLines)
+	if line >= 0 && line < len(lines) {
+		from, to = max(line-reviewCommentContext, 0), min(line+reviewCommentContext+1, len(lines))
+	}
+
+	res := make([]string, 0, to-from)
+	for _, l := range lines[from:to] {
+		l = diffMarkerRe.ReplaceAllStringFunc(l, func(m string) string {
+			marker := strings.Replace(m[len(m)-1:], "~", "!", 1)
+			return marker + m[:len(m)-1]
+		})
+		res = append(res, l)
+	}
+	return strings.Join(res, "\n")
+}
+
+// formatReviewComment renders the comment for the VCS, not all of them support collapsible sections.
+func formatReviewComment(vcsType models.VCSHostType, user string, c reviewComment, diff uiDiff, link string) string {
+	// fence must be longer than any backtick run in the diff
+	fence := "```"
+	for strings.Contains(diff.Diff, fence) {
+		fence += "`"
+	}
+	excerpt := fmt.Sprintf("%sdiff\n%s\n%s", fence, diffExcerpt(diff.Diff, c.Line), fence)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "💬 **%s** commented on `%s` in `%s`:\n\n%s\n\n", user, c.Address, c.Stack, strings.TrimSpace(c.Body))
+	switch vcsType {
+	case models.Github, models.Gitlab, models.Gitea:
+		fmt.Fprintf(&b, "<details><summary>Diff excerpt</summary>\n\n%s\n</details>\n\n", excerpt)
+	default:
+		fmt.Fprintf(&b, "%s\n\n", excerpt)
+	}
+	fmt.Fprintf(&b, "[Show in plan UI](%s)", link)
+	return b.String()
+}
@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 //go:embed ui
@@ -17,6 +24,11 @@ var ui embed.FS
 var (
 	devUIServe = flag.Bool("dev-ui", false, "serve the UI from filesystem instead of embedded")
 	servePath  = flag.String("serve-path", "/", "path to serve the UI on")
+
+	readTimeout     = flag.Duration("read-timeout", 30*time.Second, "Timeout for reading requests, including the body")
+	writeTimeout    = flag.Duration("write-timeout", 0, "Timeout for writing responses, 0 for none. If set, server-sent events on /events are reconnected after it")
+	idleTimeout     = flag.Duration("idle-timeout", 120*time.Second, "Timeout for idle keep-alive connections")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "Time to wait for in-flight requests on SIGTERM or SIGINT")
 )
 
 func runServe(addr string) error {
@@ -24,18 +36,161 @@ func runServe(addr string) error {
 		return fmt.Errorf("no -output-dir specified")
 	}
 
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return fmt.Errorf("both -tls-cert and -tls-key must be specified")
+	}
+	if *tlsCert == "" && (*tlsClientCA != "" || *tlsRedirectAddr != "") {
+		return fmt.Errorf("no -tls-cert specified, it's required for -tls-client-ca and -tls-redirect-addr")
+	}
+
 	uiFS, _ := fs.Sub(ui, "ui")
 	if *devUIServe {
 		uiFS = os.DirFS("ui")
 	}
 
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return err
+	}
+
+	watcher, err := newSnapshotWatcher(*outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to watch output dir: %w", err)
+	}
+	defer watcher.close()
+
+	versionInfo, err := getVersionInfo(uiFS)
+	if err != nil {
+		return fmt.Errorf("failed to hash UI assets: %w", err)
+	}
+
 	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServer(http.FS(uiFS)))
-	mux.Handle("/plans/", http.StripPrefix("/plans/", http.FileServer(http.FS(os.DirFS(*outputDir)))))
+	mux.Handle("/", instrumentHandler("/", http.FileServer(http.FS(uiFS))))
+	mux.Handle("/plans/", instrumentHandler("/plans/", http.StripPrefix("/plans/", countSnapshots(http.FileServer(http.FS(os.DirFS(*outputDir)))))))
+	mux.Handle("/events", instrumentHandler("/events", watcher))
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/readyz", readyz)
+	mux.Handle("/version", versionHandler(versionInfo))
+
+	if *approvalStatus && *acksDB == "" {
+		return fmt.Errorf("no -acks-db specified, it's required for -approval-status")
+	}
+
+	var poster *commentPoster
+	if *reviewComments || *approvalStatus {
+		if *uiURL == "" {
+			return fmt.Errorf("no -plan-ui-url specified, it's required for links in comments and statuses")
+		}
+		poster, err = getCommentPoster()
+		if err != nil {
+			return fmt.Errorf("failed to get comment poster: %w", err)
+		}
+	}
+
+	if *acksDB != "" {
+		auth, err := newAuthenticator()
+		if err != nil {
+			return fmt.Errorf("failed to configure authentication, it's required for -acks-db: %w", err)
+		}
+
+		acks, err := newAckStore(*acksDB)
+		if err != nil {
+			return fmt.Errorf("failed to open acks DB: %w", err)
+		}
+		defer acks.db.Close()
+		acks.auth = auth
+		if *approvalStatus {
+			acks.approvals = poster
+		}
+		mux.Handle("/api/acks", instrumentHandler("/api/acks", acks))
+	}
+
+	if *reviewComments {
+		auth, err := newAuthenticator()
+		if err != nil {
+			return fmt.Errorf("failed to configure authentication, it's required for -review-comments: %w", err)
+		}
+		mux.Handle("/api/comments", instrumentHandler("/api/comments", &reviewCommenter{poster: poster, auth: auth}))
+	}
 
 	// otherwise StripPrefix will redirect /foo to foo, which will cause redirect loops
 	*servePath = strings.TrimRight(*servePath, "/")
 
-	log.Printf("Serving UI on %s%s", addr, *servePath)
-	return http.ListenAndServe(addr, http.StripPrefix(*servePath, mux))
+	var handler http.Handler = mux
+	if *tlsClientCA != "" {
+		handler = requireClientCert(mux)
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           http.StripPrefix(*servePath, handler),
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+	// event streams never become idle, so they are closed for Shutdown to finish
+	srv.RegisterOnShutdown(watcher.close)
+
+	servers := []*http.Server{srv}
+	if *tlsCert != "" {
+		certs, err := newCertReloader(*tlsCert, *tlsKey)
+		if err != nil {
+			return err
+		}
+		defer certs.close()
+
+		srv.TLSConfig, err = serverTLSConfig(certs)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+
+		if *tlsRedirectAddr != "" {
+			servers = append(servers, &http.Server{
+				Addr:              *tlsRedirectAddr,
+				Handler:           httpsRedirect(addr),
+				ReadHeaderTimeout: *readTimeout,
+				IdleTimeout:       *idleTimeout,
+			})
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	errc := make(chan error, len(servers))
+	go func() {
+		if srv.TLSConfig != nil {
+			slog.Info("serving UI over HTTPS", "addr", addr, "path", *servePath, "mtls", *tlsClientCA != "")
+			// certificates come from TLSConfig.GetCertificate
+			errc <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		slog.Info("serving UI", "addr", addr, "path", *servePath)
+		errc <- srv.ListenAndServe()
+	}()
+	for _, s := range servers[1:] {
+		go func() {
+			slog.Info("redirecting HTTP to HTTPS", "addr", s.Addr)
+			errc <- s.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "timeout", *shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	// all servers share the deadline, so a stuck one doesn't leave the others running
+	var errs []error
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down %s gracefully: %w", s.Addr, err))
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+var repoDir = flag.String("repo-dir", "", "Path to the PR's repo checkout (e.g. $DIR in Atlantis hooks), enables Terragrunt dependency graph")
+
+// stackGraph is a dependency graph of Terragrunt stacks in the repo, keyed by repo-relative stack dirs.
+type stackGraph struct {
+	// upstream are stacks the key stack depends on
+	upstream map[string][]string
+	// downstream are stacks depending on the key stack
+	downstream map[string][]string
+}
+
+// loadTerragruntGraph parses all terragrunt.hcl files in the repo and builds a graph from
+// `dependency` and `dependencies` blocks. Downstream stacks are collected from the whole repo,
+// not only from the stacks in the PR, as they are affected by output changes too.
+func loadTerragruntGraph(root string) (*stackGraph, error) {
+	g := &stackGraph{
+		upstream:   make(map[string][]string),
+		downstream: make(map[string][]string),
+	}
+
+	err := walkFiles(root, func(path string, d fs.DirEntry) error {
+		if d.Name() != "terragrunt.hcl" {
+			return nil
+		}
+
+		stack, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+
+		body, err := parseHCLFile(path)
+		if err != nil {
+			// a single broken config shouldn't break the graph for other stacks
+			slog.Warn("failed to parse Terragrunt config", "file", path, "err", err)
+			return nil
+		}
+
+		for _, dep := range terragruntDeps(root, stack, body) {
+			g.upstream[stack] = append(g.upstream[stack], dep)
+			g.downstream[dep] = append(g.downstream[dep], stack)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range []map[string][]string{g.upstream, g.downstream} {
+		for k, v := range m {
+			slices.Sort(v)
+			m[k] = slices.Compact(v)
+		}
+	}
+	return g, nil
+}
+
+func parseHCLFile(fname string) (*hclsyntax.Body, error) {
+	src, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := hclsyntax.ParseConfig(src, fname, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return file.Body.(*hclsyntax.Body), nil
+}
+
+// terragruntDeps returns repo-relative dirs of stacks the stack depends on, keyed by dependency name.
+// Paths from `dependencies` block are keyed by the path itself.
+func terragruntDeps(root, stack string, body *hclsyntax.Body) map[string]string {
+	ctx := terragruntEvalContext(root, stack)
+	resolve := func(expr hclsyntax.Expression) []string {
+		val, diags := expr.Value(ctx)
+		if diags.HasErrors() || !val.IsWhollyKnown() || val.IsNull() {
+			// only literal paths and a few functions are supported, we don't run terragrunt
+			return nil
+		}
+
+		var vals []cty.Value
+		if val.Type() == cty.String {
+			vals = []cty.Value{val}
+		} else if val.CanIterateElements() {
+			vals = val.AsValueSlice()
+		}
+
+		var res []string
+		for _, v := range vals {
+			if v.Type() != cty.String || v.IsNull() {
+				continue
+			}
+			if dep, ok := repoRelPath(root, stack, v.AsString()); ok {
+				res = append(res, dep)
+			}
+		}
+		return res
+	}
+
+	res := make(map[string]string)
+	for _, block := range body.Blocks {
+		switch {
+		case block.Type == "dependency" && len(block.Labels) == 1:
+			if attr := block.Body.Attributes["config_path"]; attr != nil {
+				if deps := resolve(attr.Expr); len(deps) == 1 {
+					res[block.Labels[0]] = deps[0]
+				}
+			}
+
+		case block.Type == "dependencies":
+			if attr := block.Body.Attributes["paths"]; attr != nil {
+				for _, dep := range resolve(attr.Expr) {
+					res[dep] = dep
+				}
+			}
+		}
+	}
+	return res
+}
+
+// terragruntEvalContext returns a context with a subset of Terragrunt functions commonly used in dependency paths.
+func terragruntEvalContext(root, stack string) *hcl.EvalContext {
+	constFunc := func(val string) function.Function {
+		return function.New(&function.Spec{
+			Type: function.StaticReturnType(cty.String),
+			Impl: func([]cty.Value, cty.Type) (cty.Value, error) {
+				return cty.StringVal(val), nil
+			},
+		})
+	}
+
+	return &hcl.EvalContext{
+		Functions: map[string]function.Function{
+			"get_terragrunt_dir": constFunc(filepath.Join(root, stack)),
+			"get_repo_root":      constFunc(root),
+		},
+	}
+}
+
+// repoRelPath converts a dependency path, relative to the stack or absolute, to a path relative to the repo root.
+func repoRelPath(root, stack, path string) (string, bool) {
+	path = strings.TrimSuffix(path, "/terragrunt.hcl")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, stack, path)
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
+}
+
+// annotateStacks fills direct upstream and all downstream stacks for each stack in the PR.
+func (g *stackGraph) annotateStacks(stacks []uiStack) {
+	for i := range stacks {
+		stacks[i].Upstream = g.upstream[stacks[i].Path]
+		stacks[i].Downstream = g.dependents(stacks[i].Path)
+	}
+}
+
+// dependents returns stacks depending on the stack directly or through other stacks,
+// as output changes might propagate through the whole chain on applies.
+func (g *stackGraph) dependents(stack string) []string {
+	seen := map[string]bool{stack: true}
+	var res []string
+	queue := []string{stack}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, down := range g.downstream[cur] {
+			if !seen[down] {
+				seen[down] = true
+				res = append(res, down)
+				queue = append(queue, down)
+			}
+		}
+	}
+	slices.Sort(res)
+	return res
+}
+
+// sortStacks orders stacks topologically, so that dependencies are listed before dependents.
+// Stacks without dependencies between them are ordered by path, g might be nil.
+func sortStacks(stacks []uiStack, g *stackGraph) {
+	slices.SortStableFunc(stacks, func(l, r uiStack) int {
+		return cmp.Compare(l.Path, r.Path)
+	})
+	if g == nil {
+		return
+	}
+
+	// Kahn's algorithm, only edges between stacks of the PR matter here
+	inPR := make(map[string]bool)
+	for _, s := range stacks {
+		inPR[s.Path] = true
+	}
+
+	inDegree := make(map[string]int)
+	for _, s := range stacks {
+		for _, up := range g.upstream[s.Path] {
+			if inPR[up] && up != s.Path {
+				inDegree[s.Path]++
+			}
+		}
+	}
+
+	res := make([]uiStack, 0, len(stacks))
+	done := make([]bool, len(stacks))
+	for len(res) < len(stacks) {
+		progress := false
+		for i, s := range stacks {
+			if done[i] || inDegree[s.Path] > 0 {
+				continue
+			}
+			done[i] = true
+			progress = true
+			res = append(res, s)
+
+			// all workspaces of the stack are emitted before its dependents are released
+			if slices.ContainsFunc(stacks[i+1:], func(o uiStack) bool { return o.Path == s.Path }) {
+				continue
+			}
+			for _, down := range g.downstream[s.Path] {
+				if inPR[down] && down != s.Path {
+					inDegree[down]--
+				}
+			}
+			break
+		}
+
+		if !progress {
+			// dependency cycle, keep the rest in path order
+			for i, s := range stacks {
+				if !done[i] {
+					done[i] = true
+					res = append(res, s)
+				}
+			}
+		}
+	}
+	copy(stacks, res)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTerragruntGraph(t *testing.T) {
+	root := t.TempDir()
+	for stack, config := range map[string]string{
+		"prod/vpc": ``,
+		"prod/eks": `dependency "vpc" {
+  config_path = "../vpc"
+}`,
+		"prod/app": `dependencies {
+  paths = ["${get_repo_root()}/prod/eks"]
+}`,
+		"prod/dns": `dependency "app" {
+  config_path = "../app"
+}
+dependency "vpc" {
+  config_path = "../vpc"
+}`,
+		// a cycle must not hang the traversal
+		"cycle/a": `dependency "b" {
+  config_path = "../b"
+}`,
+		"cycle/b": `dependency "a" {
+  config_path = "../a"
+}`,
+	} {
+		if err := os.MkdirAll(filepath.Join(root, stack), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, stack, "terragrunt.hcl"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g, err := loadTerragruntGraph(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stacks := []uiStack{{Path: "prod/vpc"}, {Path: "prod/app"}, {Path: "cycle/a"}}
+	g.annotateStacks(stacks)
+
+	for _, tc := range []struct {
+		stack          uiStack
+		wantUpstream   []string
+		wantDownstream []string
+	}{
+		{stack: stacks[0], wantDownstream: []string{"prod/app", "prod/dns", "prod/eks"}},
+		{stack: stacks[1], wantUpstream: []string{"prod/eks"}, wantDownstream: []string{"prod/dns"}},
+		{stack: stacks[2], wantUpstream: []string{"cycle/b"}, wantDownstream: []string{"cycle/b"}},
+	} {
+		if !reflect.DeepEqual(tc.stack.Upstream, tc.wantUpstream) {
+			t.Errorf("upstream of %s = %v, want %v", tc.stack.Path, tc.stack.Upstream, tc.wantUpstream)
+		}
+		if !reflect.DeepEqual(tc.stack.Downstream, tc.wantDownstream) {
+			t.Errorf("downstream of %s = %v, want %v", tc.stack.Path, tc.stack.Downstream, tc.wantDownstream)
+		}
+	}
+}
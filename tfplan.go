@@ -5,23 +5,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
 	"strings"
-	"unicode"
 )
 
 type tfPlan struct {
-	FormatVersion   string              `json:"format_version"`
-	ResourceDrift   []tfResourceChange  `json:"resource_drift"`
-	ResourceChanges []tfResourceChange  `json:"resource_changes"`
-	OutputChanges   map[string]tfChange `json:"output_changes"`
-	Timestamp       string              `json:"timestamp"`
+	FormatVersion    string              `json:"format_version"`
+	TerraformVersion string              `json:"terraform_version"` // OpenTofu uses the same field
+	ResourceDrift    []tfResourceChange  `json:"resource_drift"`
+	ResourceChanges  []tfResourceChange  `json:"resource_changes"`
+	OutputChanges    map[string]tfChange `json:"output_changes"`
+	Timestamp        string              `json:"timestamp"`
 }
 
 type tfResourceChange struct {
 	Address         string   `json:"address"`
 	PreviousAddress string   `json:"previous_address"`
+	ModuleAddress   string   `json:"module_address"`
 	Mode            string   `json:"mode"`
+	Type            string   `json:"type"`
+	ProviderName    string   `json:"provider_name"`
 	Change          tfChange `json:"change"`
 }
 
@@ -34,7 +36,7 @@ type tfChange struct {
 	//    ["delete", "create"] (replace)
 	//    ["create", "delete"] (replace)
 	//    ["delete"]
-	//    ["forget"]
+	//    ["forget"] (removed blocks in both Terraform and OpenTofu)
 	//    ["create", "forget"] (replace)
 	Actions []string `json:"actions"`
 
@@ -44,6 +46,9 @@ type tfChange struct {
 	} `json:"importing"`
 }
 
+// parseJSONPlan parses the output of a terraform show -json $PLANFILE.
+// Plans might be hundreds of megabytes because of before/after values and prior state, so the plan is decoded
+// as a stream of tokens, and only the fields needed for the UI are kept in memory, everything else is skipped.
 func parseJSONPlan(fname string) (*tfPlan, error) {
 	f, err := os.Open(fname)
 	if err != nil {
@@ -52,139 +57,196 @@ func parseJSONPlan(fname string) (*tfPlan, error) {
 	defer f.Close()
 
 	var res tfPlan
-	if err := json.NewDecoder(f).Decode(&res); err != nil {
+	dec := json.NewDecoder(bufio.NewReader(f))
+	err = decodeObject(dec, func(key string) error {
+		switch key {
+		case "format_version":
+			return dec.Decode(&res.FormatVersion)
+		case "terraform_version":
+			return dec.Decode(&res.TerraformVersion)
+		case "timestamp":
+			return dec.Decode(&res.Timestamp)
+		case "resource_changes":
+			return decodeArray(dec, func() error {
+				rc, err := decodeResourceChange(dec)
+				res.ResourceChanges = append(res.ResourceChanges, rc)
+				return err
+			})
+		case "resource_drift":
+			return decodeArray(dec, func() error {
+				rc, err := decodeResourceChange(dec)
+				res.ResourceDrift = append(res.ResourceDrift, rc)
+				return err
+			})
+		case "output_changes":
+			res.OutputChanges = make(map[string]tfChange)
+			return decodeObject(dec, func(name string) error {
+				ch, err := decodeChange(dec)
+				res.OutputChanges[name] = ch
+				return err
+			})
+		default:
+			// prior_state, planned_values, configuration, etc. are the largest parts of the plan
+			return skipValue(dec)
+		}
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	if res.FormatVersion[:2] != "1." {
+	// OpenTofu forked with the same JSON format and keeps it compatible, so the check is the same for both
+	if !strings.HasPrefix(res.FormatVersion, "1.") {
 		return nil, fmt.Errorf("unsupported format version: %s", res.FormatVersion)
 	}
 
 	return &res, nil
 }
 
-type textualValues struct {
-	diffs   map[string]string
-	drifts  map[string]string
-	outputs map[string]string
-}
+const (
+	engineTerraform = "terraform"
+	engineOpenTofu  = "opentofu"
+)
 
-// parseTextPlan parses the output of a terraform show $PLANFILE and extracts diffs and drifts per resource.
-// This is least hacky way to get familiar terraform-formatted output,
-// as all terraform packages are internal, unfortunately.
-func parseTextPlan(fname string) (*textualValues, error) {
-	f, err := os.Open(fname)
-	if err != nil {
-		return nil, err
+// detectEngine guesses whether the plan was produced by Terraform or OpenTofu.
+// JSON plans of both have the same shape and `terraform_version` field, so look at provider registry
+// and at the wording of the text plan.
+func detectEngine(tf *tfPlan, txt *textualValues) string {
+	if txt.engine != "" {
+		return txt.engine
 	}
-	defer f.Close()
+	for _, rc := range tf.ResourceChanges {
+		if strings.HasPrefix(rc.ProviderName, "registry.opentofu.org/") {
+			return engineOpenTofu
+		}
+	}
+	return engineTerraform
+}
+
+func decodeResourceChange(dec *json.Decoder) (tfResourceChange, error) {
+	var res tfResourceChange
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "address":
+			return dec.Decode(&res.Address)
+		case "previous_address":
+			return dec.Decode(&res.PreviousAddress)
+		case "module_address":
+			return dec.Decode(&res.ModuleAddress)
+		case "mode":
+			return dec.Decode(&res.Mode)
+		case "type":
+			return dec.Decode(&res.Type)
+		case "provider_name":
+			return dec.Decode(&res.ProviderName)
+		case "change":
+			ch, err := decodeChange(dec)
+			res.Change = ch
+			return err
+		default:
+			return skipValue(dec)
+		}
+	})
+	return res, err
+}
 
-	diffs := make(map[string]string)
-	drifts := make(map[string]string)
-	outputs := make(map[string]string)
-
-	const (
-		stateMain = iota
-		stateInResource
-		stateInOutputs
-	)
-	state := stateMain
-
-	s := bufio.NewScanner(f)
-	var curDiffLines []string
-	for s.Scan() {
-		line := strings.TrimRightFunc(s.Text(), unicode.IsSpace)
-		switch state {
-		case stateMain:
-			if strings.HasPrefix(strings.TrimSpace(line), "# ") {
-				state = stateInResource
-				curDiffLines = []string{line}
-			}
-			if line == "Changes to Outputs:" {
-				state = stateInOutputs
-			}
-
-		case stateInResource:
-			curDiffLines = append(curDiffLines, line)
-			if line == "    }" {
-				diffHeader := curDiffLines[0]
-				addr := getAddressFromTxtDiff(diffHeader)
-				txtDiff := strings.Join(curDiffLines, "\n")
-
-				if strings.HasSuffix(diffHeader, "has changed") || strings.HasSuffix(diffHeader, "has been deleted") {
-					drifts[addr] = txtDiff
-				} else {
-					diffs[addr] = txtDiff
-				}
-				state = stateMain
-			}
-
-		case stateInOutputs:
-			if strings.HasPrefix(line, "You can apply this plan") {
-				addr := getAddressFromTxtDiff(curDiffLines[0])
-				// -1 due to last empty line before the message
-				outputs[addr] = strings.Join(curDiffLines[:len(curDiffLines)-1], "\n")
-				state = stateMain
-			}
-
-			if ok, _ := regexp.MatchString(`^  [-+~] `, line); ok {
-				if len(curDiffLines) > 0 {
-					addr := getAddressFromTxtDiff(curDiffLines[0])
-					outputs[addr] = strings.Join(curDiffLines, "\n")
-				}
-				curDiffLines = []string{line}
-			} else {
-				curDiffLines = append(curDiffLines, line)
-			}
+// decodeChange decodes a change, skipping before/after values, which might be huge.
+func decodeChange(dec *json.Decoder) (tfChange, error) {
+	var res tfChange
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "actions":
+			return dec.Decode(&res.Actions)
+		case "importing":
+			return dec.Decode(&res.Importing)
+		default:
+			return skipValue(dec)
+		}
+	})
+	return res, err
+}
+
+// decodeObject reads a JSON object from the stream and calls fn for each key.
+// fn must consume the value of the key from the decoder.
+// null is treated as an empty object.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	if isNull, err := expectOpenDelim(dec, '{'); isNull || err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", tok)
+		}
+		if err := fn(key); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
 		}
 	}
+	return expectDelim(dec, '}')
+}
 
-	if state == stateInOutputs && len(curDiffLines) > 0 && len(curDiffLines[0]) > 0 {
-		// process the last output
-		addr := getAddressFromTxtDiff(curDiffLines[0])
-		outputs[addr] = strings.Join(curDiffLines, "\n")
+// decodeArray reads a JSON array from the stream and calls fn for each element.
+// fn must consume the element from the decoder.
+// null is treated as an empty array.
+func decodeArray(dec *json.Decoder, fn func() error) error {
+	if isNull, err := expectOpenDelim(dec, '['); isNull || err != nil {
+		return err
+	}
+	for dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
 	}
+	return expectDelim(dec, ']')
+}
 
-	if err := s.Err(); err != nil {
-		return nil, err
+// expectOpenDelim reads the opening delimiter of an object or array, returns true if the value is null instead.
+func expectOpenDelim(dec *json.Decoder, delim json.Delim) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if tok == nil {
+		return true, nil
 	}
+	if tok != delim {
+		return false, fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return false, nil
+}
 
-	return &textualValues{
-		diffs:   diffs,
-		drifts:  drifts,
-		outputs: outputs,
-	}, nil
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
 }
 
-// getAddressFromTxtDiff gets the Terraform resource address from a start of line of text, dropping spaces at start and next 2 chars.
-// Examples:
-// - `  # aws_vpc.this[0] will be created` -> `aws_vpc.this[0]`
-// - `  # aws_vpc.this["some string"].out["bar/baz"]: ...` -> `aws_vpc.this["some string"].out["bar/baz"]`
-// - `  + some_output = "test"` -> `some_output`
-func getAddressFromTxtDiff(s string) string {
-	s = strings.TrimSpace(s)[2:] // trim `  [#-+~] ` prefix
-
-	inQuoted := false
-	for i, ch := range s {
-		// valid TF resource address characters
-		if unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '.' || ch == '[' || ch == ']' || ch == '-' || ch == '_' {
-			continue
+// skipValue consumes the next value from the stream without keeping it in memory.
+// Tokens are still decoded one by one, so skipped strings are allocated and dropped right away:
+// this keeps the peak heap low, at the cost of more allocations than decoding the whole plan.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
 		}
-
-		// quoted string in resource address, allow all characters
-		if inQuoted && ch != '"' {
-			continue
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
 		}
-
-		// start/end of quoted string
-		if ch == '"' {
-			inQuoted = !inQuoted
-			continue
+		if depth == 0 {
+			return nil
 		}
-
-		// stop at the first invalid character
-		return s[:i]
 	}
-
-	return ""
 }
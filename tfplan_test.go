@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+	"testing"
+	"time"
+)
+
+var bigPlanMB = flag.Int64("big-plan-mb", 16, "Size of the plan generated for BenchmarkParseJSONPlanMemory, in megabytes")
+
+// countingWriter counts bytes written through it, so that generated plans stop at the requested size.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeBigPlan writes plan.json and plan.txt of a synthetic stack into dir, adding resources until plan.json
+// is at least size bytes. Resources are IAM policies with big documents in before/after values, planned values
+// and prior state, which is what makes real plans huge. It returns the number of resources.
+func writeBigPlan(tb testing.TB, dir string, size int64) int {
+	tb.Helper()
+
+	jsonFile, err := os.Create(filepath.Join(dir, "plan.json"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer jsonFile.Close()
+	txtFile, err := os.Create(filepath.Join(dir, "plan.txt"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer txtFile.Close()
+
+	jbuf := bufio.NewWriter(jsonFile)
+	jw := &countingWriter{w: jbuf}
+	tw := bufio.NewWriter(txtFile)
+
+	statement := `{"Effect":"Allow","Action":["s3:GetObject","s3:PutObject"],"Resource":"arn:aws:s3:::bucket-%d/*"},`
+	policy := func(i, version int) string {
+		doc := fmt.Sprintf(`{"Version":"2012-10-17","Statement":[%s{"Sid":"v%d"}]}`,
+			strings.Repeat(fmt.Sprintf(statement, i), 50), version)
+		b, _ := json.Marshal(doc)
+		return string(b)
+	}
+
+	// resources are written twice, to resource_changes and to prior_state, so the budget is split in halves
+	fmt.Fprint(jw, `{"format_version":"1.2","terraform_version":"1.9.8","resource_changes":[`)
+	n := 0
+	for ; jw.n < size/2; n++ {
+		if n > 0 {
+			fmt.Fprint(jw, ",")
+		}
+		actions, verb := `["update"]`, "updated in-place"
+		if n%10 == 0 {
+			actions, verb = `["delete","create"]`, "replaced"
+		}
+		fmt.Fprintf(jw, `{"address":"aws_iam_policy.p[%d]","mode":"managed","type":"aws_iam_policy","name":"p","index":%d,`+
+			`"provider_name":"registry.terraform.io/hashicorp/aws","change":{"actions":%s,`+
+			`"before":{"id":"p%d","policy":%s},"after":{"id":"p%d","policy":%s},`+
+			`"after_unknown":{},"before_sensitive":{},"after_sensitive":{}}}`,
+			n, n, actions, n, policy(n, 1), n, policy(n, 2))
+
+		fmt.Fprintf(tw, "  # aws_iam_policy.p[%d] will be %s\n", n, verb)
+		fmt.Fprintf(tw, "  ~ resource \"aws_iam_policy\" \"p\" {\n        id     = \"p%d\"\n", n)
+		fmt.Fprint(tw, "      ~ policy = jsonencode(\n            {\n              ~ Statement = [\n")
+		fmt.Fprintf(tw, "                  ~ {\n                      ~ Sid = \"v1\" -> \"v2\"\n                    },\n")
+		fmt.Fprint(tw, "                ]\n                # (1 unchanged attribute hidden)\n            }\n        )\n    }\n\n")
+	}
+	fmt.Fprint(jw, `],"prior_state":{"format_version":"1.0","values":{"root_module":{"resources":[`)
+	for i := range n {
+		if i > 0 {
+			fmt.Fprint(jw, ",")
+		}
+		fmt.Fprintf(jw, `{"address":"aws_iam_policy.p[%d]","mode":"managed","type":"aws_iam_policy","name":"p","index":%d,`+
+			`"values":{"id":"p%d","policy":%s},"sensitive_values":{}}`, i, i, i, policy(i, 1))
+	}
+	fmt.Fprint(jw, `]}}},"output_changes":{"policy_count":{"actions":["no-op"],"before":1,"after":1}},"timestamp":"2024-01-01T00:00:00Z"}`)
+	fmt.Fprintf(tw, "Plan: %d to add, %d to change, %d to destroy.\n", (n+9)/10, n-(n+9)/10, (n+9)/10)
+
+	if err := jbuf.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := tw.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	return n
+}
+
+func TestWriteBigPlan(t *testing.T) {
+	dir := t.TempDir()
+	n := writeBigPlan(t, dir, 1<<20)
+
+	var uiPrj uiStack
+	if err := convertPlanDir(&uiPrj, dir+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if len(uiPrj.ResourceDiffs) != n {
+		t.Errorf("got %d diffs, want %d", len(uiPrj.ResourceDiffs), n)
+	}
+}
+
+func BenchmarkParseJSONPlan(b *testing.B) {
+	dir := b.TempDir()
+	writeBigPlan(b, dir, 64<<20)
+	fi, err := os.Stat(filepath.Join(dir, "plan.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(fi.Size())
+	b.ResetTimer()
+	for range b.N {
+		if _, err := parseJSONPlan(filepath.Join(dir, "plan.json")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseJSONPlanMemory compares memory used by the streaming decoder and by decoding the whole plan,
+// run with e.g. `go test -run '^$' -bench Memory -benchtime 1x -big-plan-mb 500` for plans of real monorepos.
+// The streaming decoder keeps the peak heap at a few megabytes regardless of the plan size, but it allocates
+// about twice the plan size in total and many more objects, as skipped values are read token by token.
+// Plans are parsed once per run, so the peak heap is what matters: it decides whether the hook fits its memory limit.
+func BenchmarkParseJSONPlanMemory(b *testing.B) {
+	dir := b.TempDir()
+	writeBigPlan(b, dir, *bigPlanMB<<20)
+	fname := filepath.Join(dir, "plan.json")
+
+	for _, tc := range []struct {
+		name  string
+		parse func() error
+	}{
+		{
+			name: "stream",
+			parse: func() error {
+				_, err := parseJSONPlan(fname)
+				return err
+			},
+		},
+		{
+			name: "unmarshal",
+			parse: func() error {
+				data, err := os.ReadFile(fname)
+				if err != nil {
+					return err
+				}
+				var res tfPlan
+				return json.Unmarshal(data, &res)
+			},
+		},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for range b.N {
+				runtime.GC()
+				var err error
+				peak = max(peak, peakHeap(func() { err = tc.parse() }))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+		})
+	}
+}
+
+// peakHeap runs fn and returns the largest size of live heap objects seen while it was running, sampled every millisecond.
+func peakHeap(fn func()) uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	read := func() uint64 {
+		metrics.Read(sample)
+		return sample[0].Value.Uint64()
+	}
+
+	done := make(chan struct{})
+	res := make(chan uint64)
+	go func() {
+		peak := read()
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				peak = max(peak, read())
+			case <-done:
+				res <- max(peak, read())
+				return
+			}
+		}
+	}()
+
+	fn()
+	close(done)
+	return <-res
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type textualValues struct {
+	diffs   map[string]string
+	drifts  map[string]string
+	outputs map[string]string
+	// notices are diagnostics printed with the plan, e.g. OpenTofu state encryption warnings or forgotten resources
+	notices []string
+
+	// engine is set if the wording of the plan points to a specific tool, see detectEngine
+	engine string
+}
+
+var (
+	// outputStartRe matches the first line of an output change, e.g. `  + some_output = "test"`
+	outputStartRe = regexp.MustCompile(`^  [-+~] `)
+	// heredocStartRe matches a line opening a heredoc, e.g. `  + user_data = <<-EOT`
+	heredocStartRe = regexp.MustCompile(`<<-?([A-Za-z_][A-Za-z0-9_]*)$`)
+	// trailingCommentRe matches comments terraform adds to the end of attribute lines
+	trailingCommentRe = regexp.MustCompile(`\s+# forces replacement$`)
+
+	// driftHeaderSuffixes are endings of resource headers in "Objects have changed outside of Terraform" section,
+	// across Terraform and OpenTofu versions.
+	driftHeaderSuffixes = []string{"has changed", "has been changed", "has been deleted"}
+
+	// openTofuLinePrefixes are top-level lines printed only by OpenTofu, e.g. "OpenTofu will perform the following actions:"
+	// Resource headers are not included, they are parsed the same way for both tools.
+	openTofuLinePrefixes = []string{"OpenTofu used", "OpenTofu will perform", "OpenTofu detected", "OpenTofu has compared"}
+)
+
+// parseTextPlan parses the output of a terraform show $PLANFILE and extracts diffs and drifts per resource.
+// This is least hacky way to get familiar terraform-formatted output,
+// as all terraform packages are internal, unfortunately.
+func parseTextPlan(fname string) (*textualValues, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := textPlanParser{
+		res: &textualValues{
+			diffs:   make(map[string]string),
+			drifts:  make(map[string]string),
+			outputs: make(map[string]string),
+		},
+	}
+
+	// bufio.Scanner has a line length limit, and single lines with huge JSON values are common in plans
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			p.feed(strings.TrimRightFunc(line, unicode.IsSpace))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.flush()
+
+	return p.res, nil
+}
+
+const (
+	blockNone = iota
+	blockResource
+	blockOutput
+)
+
+// textPlanParser splits the plan into blocks: resource diffs (including drifts) and output diffs.
+// Blocks are delimited by tracking the depth of brackets and heredocs, so that nested blocks,
+// multi-line values and indentation differences between versions don't matter.
+type textPlanParser struct {
+	res *textualValues
+
+	inOutputs bool
+
+	kind  int
+	lines []string
+	// diagnostic collects lines of a boxed warning or error, nil outside of it
+	diagnostic []string
+	// opened is set once the body of the resource block is started, after the header and notes
+	opened  bool
+	depth   int
+	heredoc string
+}
+
+func (p *textPlanParser) feed(line string) {
+	if p.heredoc != "" {
+		// heredoc contents are opaque, they could contain anything, including brackets and `#`
+		p.lines = append(p.lines, line)
+		if trimmed := strings.TrimSpace(line); trimmed == p.heredoc || strings.HasPrefix(trimmed, p.heredoc+" ") {
+			p.heredoc = ""
+			p.maybeEndResource()
+		}
+		return
+	}
+
+	trimmed := strings.TrimSpace(line)
+	if p.depth == 0 && p.feedDiagnostic(trimmed) {
+		return
+	}
+
+	if p.depth == 0 && p.kind == blockNone {
+		for _, prefix := range openTofuLinePrefixes {
+			if strings.HasPrefix(line, prefix) {
+				p.res.engine = engineOpenTofu
+			}
+		}
+	}
+
+	if p.depth == 0 && !p.topLevel(line, trimmed) {
+		return
+	}
+
+	p.lines = append(p.lines, line)
+	p.trackDepth(trimmed)
+	p.maybeEndResource()
+}
+
+// feedDiagnostic collects diagnostics, which look the same in Terraform and OpenTofu:
+//
+//	╷
+//	│ Warning: Some objects will no longer be managed by Terraform
+//	│
+//	│ If you apply this plan, Terraform will discard its tracking information for
+//	╵
+//
+// It returns whether the line is a part of a diagnostic.
+func (p *textPlanParser) feedDiagnostic(trimmed string) bool {
+	switch {
+	case trimmed == "╷":
+		p.flush()
+		p.diagnostic = []string{}
+	case p.diagnostic == nil:
+		return false
+	case trimmed == "╵":
+		if text := strings.TrimSpace(strings.Join(p.diagnostic, "\n")); text != "" {
+			p.res.notices = append(p.res.notices, text)
+		}
+		p.diagnostic = nil
+	default:
+		text, _ := strings.CutPrefix(trimmed, "│")
+		p.diagnostic = append(p.diagnostic, strings.TrimPrefix(text, " "))
+	}
+	return true
+}
+
+// topLevel handles a line outside any brackets, it returns whether the line belongs to the current block.
+func (p *textPlanParser) topLevel(line, trimmed string) bool {
+	if p.kind == blockResource && !p.opened {
+		switch {
+		case strings.HasPrefix(trimmed, "# ("):
+			// notes after the header, e.g. `# (moved from ...)` or `# (config refers to values not yet known)`
+			return true
+		case trimmed == "":
+			return false
+		case !strings.HasPrefix(trimmed, "# "):
+			// `resource "type" "name" {` line
+			p.opened = true
+			return true
+		}
+	}
+
+	if strings.HasPrefix(trimmed, "# ") && !strings.HasPrefix(trimmed, "# (") {
+		if getAddressFromTxtDiff(trimmed) != "" {
+			p.flush()
+			p.kind = blockResource
+			return true
+		}
+	}
+
+	if line == "Changes to Outputs:" {
+		p.flush()
+		p.inOutputs = true
+		return false
+	}
+
+	if p.inOutputs {
+		switch {
+		case outputStartRe.MatchString(line):
+			p.flush()
+			p.kind = blockOutput
+			return true
+		case trimmed == "":
+			return false
+		case !strings.HasPrefix(line, " "):
+			// e.g. "You can apply this plan..." or a separator line
+			p.flush()
+			p.inOutputs = false
+			return false
+		}
+		return p.kind == blockOutput
+	}
+
+	return false
+}
+
+func (p *textPlanParser) trackDepth(trimmed string) {
+	trimmed = trailingCommentRe.ReplaceAllString(trimmed, "")
+	if m := heredocStartRe.FindStringSubmatch(trimmed); m != nil {
+		p.heredoc = m[1]
+		return
+	}
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return
+	}
+
+	if strings.ContainsRune("}])", rune(trimmed[0])) && p.depth > 0 {
+		p.depth--
+	}
+	if strings.ContainsRune("{[(", rune(trimmed[len(trimmed)-1])) {
+		p.depth++
+	}
+}
+
+func (p *textPlanParser) maybeEndResource() {
+	if p.kind == blockResource && p.opened && p.depth == 0 && p.heredoc == "" {
+		p.flush()
+	}
+}
+
+// flush stores the current block, if any, and resets the parser to the top level.
+func (p *textPlanParser) flush() {
+	defer func() {
+		p.kind = blockNone
+		p.lines = nil
+		p.opened = false
+		p.depth = 0
+		p.heredoc = ""
+	}()
+
+	if len(p.lines) == 0 {
+		return
+	}
+
+	header := strings.TrimSpace(p.lines[0])
+	addr := getAddressFromTxtDiff(header)
+	txtDiff := strings.Join(p.lines, "\n")
+
+	switch p.kind {
+	case blockResource:
+		isDrift := false
+		for _, suffix := range driftHeaderSuffixes {
+			if strings.HasSuffix(header, suffix) {
+				isDrift = true
+			}
+		}
+
+		if isDrift {
+			p.res.drifts[addr] = txtDiff
+		} else {
+			p.res.diffs[addr] = txtDiff
+		}
+
+	case blockOutput:
+		p.res.outputs[addr] = txtDiff
+	}
+}
+
+// getAddressFromTxtDiff gets the Terraform resource address from a start of line of text, dropping spaces at start and next 2 chars.
+// Examples:
+// - `  # aws_vpc.this[0] will be created` -> `aws_vpc.this[0]`
+// - `  # aws_vpc.this["some string"].out["bar/baz"]: ...` -> `aws_vpc.this["some string"].out["bar/baz"]`
+// - `  + some_output = "test"` -> `some_output`
+func getAddressFromTxtDiff(s string) string {
+	s = strings.TrimSpace(s)[2:] // trim `  [#-+~] ` prefix
+
+	inQuoted := false
+	for i, ch := range s {
+		// valid TF resource address characters
+		if unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '.' || ch == '[' || ch == ']' || ch == '-' || ch == '_' {
+			continue
+		}
+
+		// quoted string in resource address, allow all characters
+		if inQuoted && ch != '"' {
+			continue
+		}
+
+		// start/end of quoted string
+		if ch == '"' {
+			inQuoted = !inQuoted
+			continue
+		}
+
+		// stop at the first invalid character
+		return s[:i]
+	}
+
+	return ""
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Update golden files in testdata")
+
+// textPlanGolden is the expected result of parseTextPlan, stored next to the plan fixture.
+type textPlanGolden struct {
+	Engine  string            `json:"engine"`
+	Diffs   map[string]string `json:"diffs"`
+	Drifts  map[string]string `json:"drifts"`
+	Outputs map[string]string `json:"outputs"`
+	Notices []string          `json:"notices,omitempty"`
+}
+
+// TestParseTextPlanGolden checks the parser against `terraform show` and `tofu show` output of different versions,
+// fixtures are named after the version that introduced the wording they cover.
+func TestParseTextPlanGolden(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/tftext/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata/tftext")
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(strings.TrimSuffix(filepath.Base(fixture), ".txt"), func(t *testing.T) {
+			txt, err := parseTextPlan(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := textPlanGolden{Engine: txt.engine, Diffs: txt.diffs, Drifts: txt.drifts, Outputs: txt.outputs, Notices: txt.notices}
+
+			golden := strings.TrimSuffix(fixture, ".txt") + ".golden.json"
+			if *updateGolden {
+				b, err := json.MarshalIndent(got, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, append(b, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			b, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run with -update to create it", err)
+			}
+			var want textPlanGolden
+			if err := json.Unmarshal(b, &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseTextPlan(%s) = %+v, want %+v", fixture, got, want)
+			}
+		})
+	}
+}
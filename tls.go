@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	tlsCert         = flag.String("tls-cert", "", "Serve HTTPS (with HTTP/2) using the certificate file, reloaded on change")
+	tlsKey          = flag.String("tls-key", "", "Private key file of -tls-cert, reloaded on change")
+	tlsClientCA     = flag.String("tls-client-ca", "", "Require client certificates signed by CAs from the PEM bundle (mTLS), except on /healthz, /readyz and /metrics")
+	tlsRedirectAddr = flag.String("tls-redirect-addr", "", "Listen for plain HTTP on the address and redirect requests to HTTPS, e.g. :80")
+)
+
+// certReloader serves the certificate from -tls-cert and -tls-key, and reloads it when the files change,
+// e.g. on renewal by cert-manager, without restarting the server.
+type certReloader struct {
+	certFile, keyFile string
+	watcher           *fsnotify.Watcher
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// dirs are watched instead of files, as mounted secrets are updated by swapping a symlink in the dir
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+	}
+	r.watcher = watcher
+
+	go r.loop()
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// certReloadDelay batches events of a single update, as the certificate and the key are written separately.
+const certReloadDelay = 500 * time.Millisecond
+
+func (r *certReloader) loop() {
+	var reload <-chan time.Time
+	for {
+		select {
+		case _, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			reload = time.After(certReloadDelay)
+
+		case <-reload:
+			// the previous certificate is kept if the new one is broken
+			if err := r.reload(); err != nil {
+				slog.Warn("failed to reload TLS certificate, keeping the previous one", "err", err)
+				continue
+			}
+			slog.Info("reloaded TLS certificate", "file", r.certFile)
+
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("TLS certificate watcher error", "err", err)
+		}
+	}
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) close() {
+	r.watcher.Close()
+}
+
+// serverTLSConfig returns the config serving certificates of the reloader, with client verification if -tls-client-ca is specified.
+func serverTLSConfig(certs *certReloader) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if *tlsClientCA != "" {
+		pem, err := os.ReadFile(*tlsClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *tlsClientCA)
+		}
+		cfg.ClientCAs = pool
+		// required by requireClientCert instead, so that probes and Prometheus can connect without a certificate
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// probePaths are served without a client certificate, as kubelet and Prometheus usually don't have one.
+var probePaths = []string{"/healthz", "/readyz", "/metrics"}
+
+// requireClientCert rejects requests without a verified client certificate, except for probePaths.
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) && !slices.Contains(probePaths, r.URL.Path) {
+			http.Error(w, "client certificate required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpsRedirect redirects requests to the same host on the port of tlsAddr.
+func httpsRedirect(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			// IPv6 literal
+			host = "[" + host + "]"
+		}
+		// 308 keeps the method and body, unlike 301
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCert issues a certificate from the template, self-signed if parent is nil.
+func newTestCert(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+func TestClientCertificates(t *testing.T) {
+	caPair, ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	caKey := caPair.PrivateKey.(*ecdsa.PrivateKey)
+	serverCert, _ := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "plans"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	clientCert, _ := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alice"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := *tlsClientCA
+	*tlsClientCA = caFile
+	defer func() { *tlsClientCA = old }()
+
+	auth, err := newAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, auth.user(r))
+	})
+
+	cfg, err := serverTLSConfig(&certReloader{cert: &serverCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// StartTLS would add its own certificate, which takes precedence over GetCertificate
+	srv := httptest.NewUnstartedServer(requireClientCert(mux))
+	srv.Listener = tls.NewListener(srv.Listener, cfg)
+	srv.Start()
+	defer srv.Close()
+	url := "https://" + srv.Listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	for _, tc := range []struct {
+		name       string
+		certs      []tls.Certificate
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "probe without certificate", path: "/healthz", wantStatus: http.StatusOK, wantBody: "ok\n"},
+		{name: "UI without certificate", path: "/whoami", wantStatus: http.StatusForbidden, wantBody: "client certificate required\n"},
+		{name: "UI with certificate", certs: []tls.Certificate{clientCert}, path: "/whoami", wantStatus: http.StatusOK, wantBody: "alice"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: tc.certs}}}
+			resp, err := client.Get(url + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.wantStatus || string(body) != tc.wantBody {
+				t.Errorf("GET %s = %d %q, want %d %q", tc.path, resp.StatusCode, body, tc.wantStatus, tc.wantBody)
+			}
+		})
+	}
+}
@@ -1,5 +1,11 @@
 export default {
-    props: ['data'],
+    props: ['data', 'selectable'],
+    emits: ['select'],
+    data() {
+        return {
+            selected: -1,
+        }
+    },
     computed: {
         lines() {
             if (!this.data) {
@@ -9,7 +15,7 @@ export default {
         }
     },
     methods: {
-        getStyle(line) {
+        getStyle(line, idx) {
             let color = 'gray'
             if (line.match(/^ +[+]/)) color = 'green'
             else if (line.match(/^ +[~]/)) color = 'yellow'
@@ -18,13 +24,21 @@ export default {
 
             let res = {}
             res['color-'+color] = true
+            res['diff-line-selected'] = idx === this.selected
             return res
+        },
+        select(idx) {
+            if (!this.selectable) {
+                return
+            }
+            this.selected = this.selected === idx ? -1 : idx
+            this.$emit('select', this.selected)
         }
     },
     template: `
         <div style="line-height: 0.9; white-space: pre;" class="hscroll pb-1">
-            <template v-for="line in lines">
-                <code :class="getStyle(line)">{{ line }}</code>
+            <template v-for="(line, idx) in lines">
+                <code :class="getStyle(line, idx)" @click="select(idx)">{{ line }}</code>
                 <br>
             </template>
         </div>`
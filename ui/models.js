@@ -4,6 +4,8 @@ class Pull {
         this.prNum = raw["pr_num"]
         this.prRepo = raw["pr_repo"]
         this.prURL = raw["pr_url"]
+        this.resourceGroups = raw["resource_groups"] || []
+        this.cost = raw["cost"] || null
 
         this.stacks = []
         for (const stackRaw of (raw["stacks"] || [])) {
@@ -29,7 +31,10 @@ class Pull {
         return this.nonErroredStacks.filter((s) => s.outputDiffs.length > 0)
     }
     get stacksWithDrifts() {
-        return this.nonErroredStacks.filter((s) => s.driftDiffs.length > 0)
+        return this.nonErroredStacks.filter((s) => s.changedDriftDiffs.length > 0)
+    }
+    get stacksWithUnchangedDrifts() {
+        return this.nonErroredStacks.filter((s) => s.unchangedDriftDiffs.length > 0)
     }
     get stacksWithMoves() {
         return this.nonErroredStacks.filter((s) => s.moves.length > 0)
@@ -44,11 +49,49 @@ class Pull {
         return this.stacks.filter((s) => s.locked)
     }
     get nonErroredStacks() {
-        return this.stacks.filter((s) => !s.planError)
+        return this.stacks.filter((s) => !s.planError && !s.conversionError)
     }
     get erroredStacks() {
         return this.stacks.filter((s) => s.planError && !s.locked)
     }
+    get conversionErroredStacks() {
+        return this.stacks.filter((s) => s.conversionError)
+    }
+
+    // setAcks assigns reviewers to resource diffs, acks are already filtered by the server to match current diffs
+    setAcks(acks) {
+        for (const s of this.stacks) {
+            for (const d of s.resourceDiffs) {
+                d.reviewers = acks
+                    .filter((a) => a["stack"] === s.path && a["address"] === d.address && a["diff_hash"] === d.diffHash)
+                    .map((a) => a["user"])
+            }
+        }
+    }
+
+    // compare returns counts of resource, output and drift diffs that were added, removed or changed in the other pull
+    compare(other) {
+        let ours = this.diffTexts
+        let theirs = other.diffTexts
+        let res = {added: 0, removed: 0, changed: 0}
+        for (const [key, diff] of theirs) {
+            if (!ours.has(key)) res.added++
+            else if (ours.get(key) !== diff) res.changed++
+        }
+        for (const key of ours.keys()) {
+            if (!theirs.has(key)) res.removed++
+        }
+        return res
+    }
+    get diffTexts() {
+        let res = new Map()
+        for (const s of this.stacks) {
+            for (const d of [].concat(s.resourceDiffs, s.outputDiffs, s.driftDiffs)) {
+                res.set(d.addressSanitized, d.diff)
+            }
+        }
+        return res
+    }
 }
 
 let sanitize = (val) => val.replaceAll(/[^a-zA-Z0-9-_]/g, "-")
@@ -59,6 +102,15 @@ class Stack {
         this.path = raw["path"] || ""
         this.logURL = raw["log_url"] || ""
         this.planError = raw["plan_error"] || false
+        this.conversionError = raw["conversion_error"] || ""
+        this.resourceGroups = raw["resource_groups"] || []
+        this.cost = raw["cost"] || null
+        this.versionChanges = raw["version_changes"] || []
+        this.upstream = raw["upstream"] || []
+        this.downstream = raw["downstream"] || []
+        this.engine = raw["engine"] || ""
+        this.engineVersion = raw["engine_version"] || ""
+        this.notices = raw["notices"] || []
 
         this.locked = false
         if (raw["lock_url"]) {
@@ -83,6 +135,20 @@ class Stack {
         )
     }
 
+    // changedDriftDiffs are drifts of resources changed by the plan, the ones Terraform shows
+    get changedDriftDiffs() {
+        return this.driftDiffs.filter((d) => !d.unchanged)
+    }
+    get unchangedDriftDiffs() {
+        return this.driftDiffs.filter((d) => d.unchanged)
+    }
+
+    get engineTitle() {
+        if (!this.engine) return ""
+        let name = this.engine === "opentofu" ? "OpenTofu" : "Terraform"
+        return this.engineVersion ? `${name} ${this.engineVersion}` : name
+    }
+
     get pathSanitized() {
         return sanitize(this.path)
     }
@@ -99,6 +165,9 @@ class Stack {
     get forgetsNum() {
         return this.resourceDiffs.filter((d) => d.actions.includes('forget')).length
     }
+    get reviewedNum() {
+        return this.resourceDiffs.filter((d) => d.reviewers.length).length
+    }
     get importsNum() {
         return this.resourceDiffs.filter((d) => d.importID).length
     }
@@ -125,6 +194,12 @@ class Stack {
     }
 }
 
+// formatCostDiff returns monthly cost difference with explicit sign, e.g. "+12.30 USD"
+let formatCostDiff = (cost) => {
+    let sign = cost["diff_monthly_cost"].startsWith("-") ? "" : "+"
+    return `${sign}${cost["diff_monthly_cost"]} ${cost["currency"]}`
+}
+
 class Diff {
     constructor(raw, stackPath, type) {
         this.address = raw["address"]
@@ -136,6 +211,13 @@ class Diff {
             this.previousAddress = raw["previous_address"]
         if (raw["import_id"])
             this.importID = raw["import_id"]
+        if (raw["diff_hash"])
+            this.diffHash = raw["diff_hash"]
+        this.reviewers = []
+        // line of the diff selected for a review comment
+        this.selectedLine = -1
+        this.consumers = raw["consumers"] || []
+        this.unchanged = raw["unchanged"] || false
 
         this.stackPath = stackPath
         this.type = type
@@ -146,4 +228,4 @@ class Diff {
     }
 }
 
-export { Pull, Stack, Diff }
\ No newline at end of file
+export { Pull, Stack, Diff, formatCostDiff }
\ No newline at end of file
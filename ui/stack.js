@@ -1,6 +1,6 @@
 import Diff from "./diff.js";
 import Counter from "./counter.js";
-import { Stack } from "./models.js"
+import { Stack, formatCostDiff } from "./models.js"
 
 export default {
     components: {Diff, Counter},
@@ -14,10 +14,15 @@ export default {
             default: {
                 outputs: true,
                 drifts: true,
+                unchangedDrifts: false,
                 refactors: true,
             },
         },
         executableName: String,
+        review: {
+            type: Object,
+            default: {enabled: false},
+        },
     },
     data() {
         return {
@@ -30,12 +35,19 @@ export default {
         }
     },
     computed: {
+        costDiff() {
+            return this.data.cost ? formatCostDiff(this.data.cost) : ""
+        },
         divID() {
             return this.data.pathSanitized
         },
         btnID() {
             return "btn-" + this.data.pathSanitized
         },
+        driftsVisible() {
+            if (!this.show.drifts) { return [] }
+            return this.data.driftDiffs.filter((d) => this.show.unchangedDrifts || !d.unchanged)
+        },
         resourcesVisible() {
             return this.data.resourceDiffsSorted.filter((d) => {
                 if (this.show.refactors) { return true }
@@ -123,6 +135,9 @@ export default {
                     <span v-else-if="data.planError" class="me-2 color-yellow" title="Plan error">
                         <i class="bi-exclamation-octagon-fill"></i>
                     </span>
+                    <span v-else-if="data.conversionError" class="me-2 color-red" title="Failed to process plan">
+                        <i class="bi-bug-fill"></i>
+                    </span>
                     <template v-else>
                         <span v-if="data.resourceDiffs.length == 0" class="me-2 color-gray" title="Zero-diff">
                             <i class="bi-patch-check-fill"></i>
@@ -131,12 +146,20 @@ export default {
                             <Counter :value="data.createsNum" :opaque="data.createsNum == 0" color="green" icon="patch-plus-fill" title="Resources to create"></Counter>
                             <Counter :value="data.updatesNum" :opaque="data.updatesNum == 0" color="orange" icon="patch-exclamation-fill" title="Resources to update"></Counter>
                             <Counter :value="data.deletesNum" :opaque="data.deletesNum == 0" color="red" icon="patch-minus-fill" title="Resources to delete"></Counter>
+                            <Counter v-if="review.enabled" :value="data.reviewedNum + '/' + data.resourceDiffs.length"
+                                :opaque="data.reviewedNum == 0" color="gray-dark" icon="check2-square" title="Reviewed resource diffs"></Counter>
                         </template>
 
                         <Counter v-if="data.outputDiffs.length > 0" :opaque="!show.outputs" 
                             :value="data.outputDiffs.length" color="blue" icon="diagram-2-fill" title="Changed outputs"></Counter>
-                        <Counter v-if="data.driftDiffs.length > 0" :opaque="!show.drifts" 
-                            :value="data.driftDiffs.length" color="indigo" icon="arrow-down-left-circle-fill" title="Remote updates"></Counter>
+                        <Counter v-if="costDiff && data.cost.diff_monthly_cost !== '0.00'" :value="costDiff"
+                            color="gray-dark" icon="cash-coin" title="Monthly cost change"></Counter>
+                        <Counter v-if="data.versionChanges.length > 0"
+                            :value="data.versionChanges.length" color="orange" icon="box-seam" title="Provider/module version changes"></Counter>
+                        <Counter v-if="data.changedDriftDiffs.length > 0" :opaque="!show.drifts" 
+                            :value="data.changedDriftDiffs.length" color="indigo" icon="arrow-down-left-circle-fill" title="Remote updates"></Counter>
+                        <Counter v-if="data.unchangedDriftDiffs.length > 0" :opaque="!show.drifts || !show.unchangedDrifts"
+                            :value="data.unchangedDriftDiffs.length" color="indigo" icon="arrow-down-left-circle" title="Remote updates of resources not changed by the plan"></Counter>
 
                         <!-- refactorings -->
                         <Counter v-if="data.moves.length > 0" :opaque="!show.refactors" 
@@ -147,10 +170,32 @@ export default {
                             :value="data.forgetsNum" color="purple" icon="x-circle" title="Resources to forget"></Counter>
                     </template>
                     {{ data.path }}
+                    <span v-if="data.engineTitle" class="ms-2 small color-gray">{{ data.engineTitle }}</span>
                 </button>
             </span>
             <div :id="divID" class="accordion-collapse collapse" data-bs-parent="#accordion">
                 <div class="accordion-body">
+                    <div v-if="data.versionChanges.length" class="mb-2 small">
+                        <div v-for="ch in data.versionChanges">
+                            <i class="bi-box-seam me-1 color-orange"></i>
+                            {{ ch.kind }} <code>{{ ch.name }}</code>:
+                            <code>{{ ch.old || '∅' }}</code> → <code>{{ ch.new || '∅' }}</code>
+                        </div>
+                    </div>
+                    <div v-if="data.upstream.length || data.downstream.length" class="mb-2 small">
+                        <div v-if="data.upstream.length">
+                            <i class="bi-arrow-up me-1 color-gray" title="Depends on"></i>
+                            Depends on: <code v-for="path in data.upstream" class="me-2">{{ path }}</code>
+                        </div>
+                        <div v-if="data.downstream.length">
+                            <i class="bi-arrow-down me-1 color-gray" title="Dependent stacks"></i>
+                            {{ data.downstream.length }} dependent stacks, including indirect:
+                            <code v-for="path in data.downstream" class="me-2">{{ path }}</code>
+                        </div>
+                    </div>
+                    <div v-for="notice in data.notices" class="alert alert-warning small py-2 mb-2">
+                        <pre class="mb-0">{{ notice }}</pre>
+                    </div>
                     <span v-if="data.lockURL">
                         This stack is locked by another PR (<a :href="data.lockPRURL">#{{ data.lockPRURL.split('/').pop() }}</a>). 
                         Check with PR author ({{ data.lockPRAuthor }}) whether it's okay to <a :href="data.lockURL">unlock</a> the stack, then re-plan.
@@ -160,7 +205,12 @@ export default {
                         <template v-if="data.logURL">See <a :href="data.logURL" target="_blank">plan log</a>.</template>
                         <template v-else>Plan log is unavailable, check PR comments or Atlantis logs.</template>
                     </span>
-                    <template v-else-if="data.resourceDiffs.length || data.outputDiffs.length || data.driftDiffs.length || data.moves.length">
+                    <span v-else-if="data.conversionError">
+                        The plan succeeded, but atlantis-plan-ui failed to process it, please file an issue:
+                        <pre class="mt-2 mb-0">{{ data.conversionError }}</pre>
+                        <template v-if="data.logURL">In the meantime, see <a :href="data.logURL" target="_blank">plan log</a>.</template>
+                    </span>
+                    <template v-else-if="data.resourceDiffs.length || data.outputDiffs.length || data.changedDriftDiffs.length || driftsVisible.length || data.moves.length">
                         <span v-if="!data.resourceDiffs.length">
                             There are no resource changes in the plan, but there are some changes in stack:<br><br>
                         </span>
@@ -170,6 +220,18 @@ export default {
                                     <span @click="copy(diff.address)" class="btn btn-light btn-sm" title="Copy resource address">
                                         <i class="bi-clipboard"></i>
                                     </span>
+                                    <span v-if="review.enabled" @click="review.toggle(data, diff)" class="btn btn-light btn-sm"
+                                          :title="diff.reviewers.length ? 'Reviewed by ' + diff.reviewers.join(', ') : 'Mark as reviewed'">
+                                        <i :class="{
+                                            'bi-check-square-fill': diff.reviewers.includes(review.user),
+                                            'bi-check-square': !diff.reviewers.includes(review.user) && diff.reviewers.length,
+                                            'bi-square': !diff.reviewers.length,
+                                        }"></i>
+                                    </span>
+                                    <span v-if="review.commentsEnabled" @click="review.comment(data, diff)" class="btn btn-light btn-sm"
+                                          :title="diff.selectedLine >= 0 ? 'Comment on selected line in PR' : 'Comment in PR, click a diff line to comment on it'">
+                                        <i class="bi-chat-left-text"></i>
+                                    </span>
                                     <button class="accordion-button accordion-button-light resource-accordion-button collapsed" data-bs-toggle="collapse"
                                             :data-bs-target="'#' + diff.addressSanitized">
                                         <template v-for="action in diff.actions">
@@ -185,7 +247,7 @@ export default {
                                 <div :id="diff.addressSanitized" class="accordion-collapse collapse"
                                      data-bs-parent="#accordion">
                                     <div class="accordion-body">
-                                        <Diff :data="diff.diff"></Diff>
+                                        <Diff :data="diff.diff" :selectable="review.commentsEnabled" @select="(line) => diff.selectedLine = line"></Diff>
                                     </div>
                                 </div>
                             </div>
@@ -210,24 +272,34 @@ export default {
                                             :data-bs-target="'#' + diff.addressSanitized">
                                         <i class="bi-diagram-2-fill me-1 color-blue"></i>
                                         <span class="ms-1 hscroll">output.{{ diff.address }}</span>
+                                        <span v-if="diff.consumers.length" class="ms-2 small color-gray" :title="diff.consumers.join(', ')">
+                                            read by {{ diff.consumers.length }} stacks
+                                        </span>
                                     </button>
                                 </span>
                                 <div :id="diff.addressSanitized" class="accordion-collapse collapse"
                                      data-bs-parent="#accordion">
                                     <div class="accordion-body">
+                                        <div v-if="diff.consumers.length" class="mb-2 small">
+                                            Read by: <code v-for="path in diff.consumers" class="me-2">{{ path }}</code>
+                                        </div>
                                         <Diff :data="diff.diff"></Diff>
                                     </div>
                                 </div>
                             </div>
-                            <div class="accordion-item" v-for="diff in data.driftDiffs" v-if="show.drifts">
+                            <div class="accordion-item" v-for="diff in driftsVisible">
                                 <span class="accordion-header resource-accordion-header" style="display: flex;">
                                     <span @click="copy(diff.address)" class="btn btn-light btn-sm">
                                         <i class="bi-clipboard"></i>
                                     </span>
                                     <button class="accordion-button accordion-button-light resource-accordion-button collapsed" data-bs-toggle="collapse"
                                             :data-bs-target="'#' + diff.addressSanitized">
-                                        <i class="bi-arrow-down-left-circle-fill me-1 color-indigo"></i>
+                                        <i :class="{
+                                            'bi-arrow-down-left-circle-fill': !diff.unchanged,
+                                            'bi-arrow-down-left-circle': diff.unchanged,
+                                        }" class="me-1 color-indigo"></i>
                                         <span class="ms-1 hscroll">{{ diff.address }}</span>
+                                        <span v-if="diff.unchanged" class="ms-2 small color-gray">not changed by the plan</span>
                                     </button>
                                 </span>
                                 <div :id="diff.addressSanitized" class="accordion-collapse collapse"
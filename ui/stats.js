@@ -1,5 +1,5 @@
 import Counter from "./counter.js";
-import {Pull} from "./models.js";
+import {Pull, formatCostDiff} from "./models.js";
 
 
 export default {
@@ -18,11 +18,15 @@ export default {
         zerodiff() { return this.pull.stacksWithZeroDiff.length },
         outputs() { return this.pull.stacksWithOutputChanges.length },
         drifts() { return this.pull.stacksWithDrifts.length },
+        unchangedDrifts() { return this.pull.stacksWithUnchangedDrifts.length },
         moves() { return this.pull.stacksWithMoves.length },
         imports() { return this.pull.stacksWithImports.length },
         forgets() { return this.pull.stacksWithForgets.length },
         locked() { return this.pull.lockedStacks.length },
         errored() { return this.pull.erroredStacks.length },
+        costDiff() { return this.pull.cost ? formatCostDiff(this.pull.cost) : "" },
+        topGroups() { return this.pull.resourceGroups.filter((g) => g.count > 1).slice(0, 5) },
+        conversionErrored() { return this.pull.conversionErroredStacks.length },
     },
     template: `
         <span class="h6 me-2">Total stacks: {{ this.pull.stacks.length }}</span>
@@ -30,6 +34,8 @@ export default {
                 :value="'errored: ' + errored"></Counter>
         <Counter v-if="locked" color="yellow" icon="hourglass-bottom" nomono
                 :value="'locked: ' + locked"></Counter>
+        <Counter v-if="conversionErrored" color="red" icon="bug-fill" nomono
+                :value="'failed to process: ' + conversionErrored"></Counter>
         <br>
         <span class="h6 me-2">With</span>
         <Counter v-if="creates" color="green" icon="patch-plus-fill" nomono
@@ -47,11 +53,25 @@ export default {
                 :value="'output changes: ' + outputs"></Counter>
         <Counter v-if="drifts" color="indigo" icon="arrow-down-left-circle-fill" nomono
                 :value="'remote changes: ' + drifts"></Counter>
+        <Counter v-if="unchangedDrifts" color="indigo" icon="arrow-down-left-circle" nomono
+                :value="'remote changes of unchanged resources: ' + unchangedDrifts"></Counter>
         <Counter v-if="moves" color="purple" icon="arrow-left-right" nomono
                 :value="'moves: ' + moves"></Counter>
         <Counter v-if="imports" color="purple" icon="box-arrow-in-down-left" nomono
                 :value="'imports: ' + imports"></Counter>
         <Counter v-if="forgets" color="purple" icon="x-circle" nomono
                 :value="'forgets: ' + forgets"></Counter>
+        <template v-if="costDiff">
+            <br>
+            <Counter color="gray-dark" icon="cash-coin" nomono :value="'monthly cost: ' + costDiff"
+                :title="pull.cost.past_monthly_cost + ' → ' + pull.cost.monthly_cost + ' ' + pull.cost.currency"></Counter>
+        </template>
+        <template v-if="topGroups.length">
+            <br>
+            <span class="h6 me-2">Largest changes</span>
+            <span v-for="g in topGroups" class="me-3 small">
+                <b>{{ g.count }}</b> <code>{{ g.type }}</code> {{ g.action }}s<template v-if="g.module"> in <code>{{ g.module }}</code></template>
+            </span>
+        </template>
 `
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var baseRef = flag.String("base-ref", "", "Git ref in -repo-dir to compare provider and module versions with, defaults to origin/<PR base branch>")
+
+// uiVersionChange is a change of a provider version in the lock file, or of a module version constraint.
+type uiVersionChange struct {
+	// Kind is either "provider" or "module"
+	Kind string `json:"kind"`
+	// Name is the provider source address for providers, or module name for modules
+	Name string `json:"name"`
+	// Old is empty if the provider or module is added, New is empty if removed
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+func (ch uiVersionChange) String() string {
+	from, to := ch.Old, ch.New
+	if from == "" {
+		from = "∅"
+	}
+	if to == "" {
+		to = "∅"
+	}
+	return fmt.Sprintf("%s `%s` %s → %s", ch.Kind, ch.Name, from, to)
+}
+
+// stackFiles reads stack files either from the checkout or from git history.
+type stackFiles interface {
+	list(dir string) ([]string, error)
+	read(fname string) ([]byte, error)
+}
+
+type checkoutFiles struct {
+	root string
+}
+
+func (c checkoutFiles) list(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(c.root, dir))
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			res = append(res, e.Name())
+		}
+	}
+	return res, nil
+}
+
+func (c checkoutFiles) read(fname string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(c.root, fname))
+}
+
+type gitFiles struct {
+	root string
+	ref  string
+}
+
+func (g gitFiles) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.root}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (g gitFiles) list(dir string) ([]string, error) {
+	out, err := g.git("ls-tree", "--name-only", g.ref, path.Clean(dir)+"/")
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			res = append(res, path.Base(line))
+		}
+	}
+	return res, nil
+}
+
+func (g gitFiles) read(fname string) ([]byte, error) {
+	return g.git("show", g.ref+":"+path.Clean(fname))
+}
+
+// annotateVersionChanges fills provider and module version changes of each stack, comparing the checkout with base ref.
+func annotateVersionChanges(root, ref string, stacks []uiStack) {
+	head := checkoutFiles{root: root}
+	base := gitFiles{root: root, ref: ref}
+
+	// Atlantis often clones only the PR branch, every provider and module would be reported as added then
+	if _, err := base.git("rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		slog.Warn("base ref not found, skipping version changes, fetch it or set -base-ref", "ref", ref, "err", err)
+		return
+	}
+
+	cache := make(map[string][]uiVersionChange)
+	for i := range stacks {
+		// workspaces of the same stack share the code
+		changes, ok := cache[stacks[i].Path]
+		if !ok {
+			var err error
+			changes, err = stackVersionChanges(head, base, stacks[i].Path)
+			if err != nil {
+				slog.Warn("failed to get version changes", "path", stacks[i].Path, "err", err)
+			}
+			cache[stacks[i].Path] = changes
+		}
+		stacks[i].VersionChanges = changes
+	}
+}
+
+func stackVersionChanges(head, base stackFiles, dir string) ([]uiVersionChange, error) {
+	headVersions, err := stackVersions(head, dir)
+	if err != nil {
+		return nil, err
+	}
+	// for new stacks, there are no files in the base, and everything is added
+	baseVersions, err := stackVersions(base, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base versions: %w", err)
+	}
+
+	var res []uiVersionChange
+	for k, v := range headVersions {
+		if baseVersions[k] != v {
+			res = append(res, uiVersionChange{Kind: k[0], Name: k[1], Old: baseVersions[k], New: v})
+		}
+	}
+	for k, v := range baseVersions {
+		if _, ok := headVersions[k]; !ok {
+			res = append(res, uiVersionChange{Kind: k[0], Name: k[1], Old: v})
+		}
+	}
+
+	slices.SortFunc(res, func(l, r uiVersionChange) int {
+		return cmp.Or(cmp.Compare(l.Kind, r.Kind), cmp.Compare(l.Name, r.Name))
+	})
+	return res, nil
+}
+
+// stackVersions returns versions of providers from the lock file and module versions from *.tf and terragrunt.hcl,
+// keyed by kind and name.
+func stackVersions(files stackFiles, dir string) (map[[2]string]string, error) {
+	names, err := files.list(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[[2]string]string)
+	for _, name := range names {
+		if name != ".terraform.lock.hcl" && name != "terragrunt.hcl" && path.Ext(name) != ".tf" {
+			continue
+		}
+
+		fname := path.Join(dir, name)
+		src, err := files.read(fname)
+		if err != nil {
+			return nil, err
+		}
+		file, diags := hclsyntax.ParseConfig(src, fname, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+			switch {
+			case name == ".terraform.lock.hcl" && block.Type == "provider" && len(block.Labels) == 1:
+				if v := literalAttr(block.Body, "version"); v != "" {
+					res[[2]string{"provider", block.Labels[0]}] = v
+				}
+
+			case name == "terragrunt.hcl" && block.Type == "terraform":
+				if v := moduleVersion(block.Body); v != "" {
+					res[[2]string{"module", "terragrunt"}] = v
+				}
+
+			case path.Ext(name) == ".tf" && block.Type == "module" && len(block.Labels) == 1:
+				if v := moduleVersion(block.Body); v != "" {
+					res[[2]string{"module", block.Labels[0]}] = v
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+// moduleVersion returns the version constraint of a registry module, or the ref of a git module source.
+func moduleVersion(body *hclsyntax.Body) string {
+	if v := literalAttr(body, "version"); v != "" {
+		return v
+	}
+
+	source := literalAttr(body, "source")
+	if i := strings.Index(source, "?"); i != -1 {
+		if q, err := url.ParseQuery(source[i+1:]); err == nil {
+			return q.Get("ref")
+		}
+	}
+	return ""
+}
+
+// literalAttr returns the value of a string attribute, if it's not a literal string, returns empty string.
+func literalAttr(body *hclsyntax.Body, name string) string {
+	attr := body.Attributes[name]
+	if attr == nil {
+		return ""
+	}
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || val.IsNull() || !val.IsKnown() || val.Type() != cty.String {
+		return ""
+	}
+	return val.AsString()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnnotateVersionChanges(t *testing.T) {
+	root := t.TempDir()
+	writeLock := func(dir, version string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		lock := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "` + version + `"
+}
+`
+		if err := os.WriteFile(filepath.Join(root, dir, ".terraform.lock.hcl"), []byte(lock), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	git("init", "-q", "-b", "main")
+	writeLock("prod", "5.0.0")
+	git("add", "-A")
+	git("commit", "-q", "-m", "base")
+	writeLock("prod", "5.1.0")
+	writeLock("new", "5.1.0")
+
+	for _, tc := range []struct {
+		name string
+		ref  string
+		want map[string][]uiVersionChange
+	}{
+		{
+			name: "base ref exists",
+			ref:  "main",
+			want: map[string][]uiVersionChange{
+				"prod": {{Kind: "provider", Name: "registry.terraform.io/hashicorp/aws", Old: "5.0.0", New: "5.1.0"}},
+				"new":  {{Kind: "provider", Name: "registry.terraform.io/hashicorp/aws", New: "5.1.0"}},
+			},
+		},
+		{
+			// e.g. single-branch clones, nothing must be reported as added
+			name: "base ref is missing",
+			ref:  "origin/main",
+			want: map[string][]uiVersionChange{"prod": nil, "new": nil},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stacks := []uiStack{{Path: "prod"}, {Path: "new"}}
+			annotateVersionChanges(root, tc.ref, stacks)
+			for _, s := range stacks {
+				if !reflect.DeepEqual(s.VersionChanges, tc.want[s.Path]) {
+					t.Errorf("version changes of %s = %+v, want %+v", s.Path, s.VersionChanges, tc.want[s.Path])
+				}
+			}
+		})
+	}
+}
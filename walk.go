@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"slices"
+)
+
+// skippedDirs are never searched for stacks and configs: VCS data, and caches of Terraform and Terragrunt,
+// which contain copies of modules and whole stacks.
+var skippedDirs = []string{".git", ".terraform", ".terragrunt-cache"}
+
+// walkFiles calls fn for each file under root, skipping skippedDirs.
+func walkFiles(root string, fn func(path string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if slices.Contains(skippedDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, d)
+	})
+}
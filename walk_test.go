@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{
+		"prod/vpc/terragrunt.hcl",
+		"prod/vpc/.terragrunt-cache/abc/prod/vpc/terragrunt.hcl",
+		"prod/vpc/.terraform/modules/vpc/main.tf",
+		".git/config",
+		".github/workflows/plan.yml",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	err := walkFiles(root, func(path string, d fs.DirEntry) error {
+		rel, err := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".github/workflows/plan.yml", "prod/vpc/terragrunt.hcl"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walkFiles() visited %v, want %v", got, want)
+	}
+}